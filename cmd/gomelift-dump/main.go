@@ -0,0 +1,79 @@
+// Command gomelift-dump decodes the auxproxy traffic in logs or recordings into readable messages.
+//
+//	gomelift-dump [-all] [-indent] [FILE]...
+//
+// It reads the files, or the standard input if none, line by line. Lines of a file written by record.Recorder
+// and log lines with frames after "sending", "recv" or "received" are decoded through the Engine.IO and
+// socket.io layers, and printed as JSON lines. Events are decoded into their pbuffer messages, and acks are
+// paired with their requests by ID within each file. Other lines are skipped.
+//
+// -all prints Engine.IO packets without socket.io packets too, such as pings, and -indent indents the JSON.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/neguse/gomelift/pkg/record"
+)
+
+// maxLineSize limits the size of a line, which holds a whole frame.
+const maxLineSize = 16 * 1024 * 1024
+
+// dump prints the messages in r, which is taken as the traffic of a connection.
+func dump(r io.Reader, enc *json.Encoder, all bool) error {
+	d := record.NewDumper()
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+	for sc.Scan() {
+		f, ok := record.ParseLogLine(sc.Text())
+		if !ok {
+			continue
+		}
+		m, ok := d.Dump(f)
+		if !ok || (m.EngineIO != "" && m.Error == "" && !all) {
+			continue
+		}
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func main() {
+	all := flag.Bool("all", false, "print Engine.IO packets without socket.io packets too")
+	indent := flag.Bool("indent", false, "indent the JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: gomelift-dump [-all] [-indent] [FILE]...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	enc := json.NewEncoder(os.Stdout)
+	if *indent {
+		enc.SetIndent("", "  ")
+	}
+	if flag.NArg() == 0 {
+		if err := dump(os.Stdin, enc, *all); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, name := range flag.Args() {
+		file, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = dump(file, enc, *all)
+		file.Close()
+		if err != nil {
+			log.Fatal(name, ": ", err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Command gomelift-local runs a local fleet standing in for the GameLift service side,
+// and drives it through its control API.
+//
+//	gomelift-local serve [-auxproxy 127.0.0.1:5757] [-control 127.0.0.1:5758] [-reservation-timeout 1m]
+//	gomelift-local processes
+//	gomelift-local create-game-session [-process ID] [-name NAME] [-max-players N] [-property KEY=VALUE]... [-data DATA] [-matchmaker-data JSON]
+//	gomelift-local game-sessions
+//	gomelift-local update-game-session -id ID [-name NAME] [-max-players N] [-property KEY=VALUE]... [-matchmaker-data JSON] [-reason REASON]
+//	gomelift-local create-player-sessions -game-session ID -player PLAYER[=DATA]...
+//	gomelift-local player-sessions [-game-session ID] [-player PLAYER] [-status STATUS]
+//	gomelift-local set-player-session-status -id ID -status STATUS
+//	gomelift-local terminate-process -process ID [-deadline 5m]
+//	gomelift-local faults
+//	gomelift-local add-fault -action ACTION [-message NAME] [-probability P] [-delay D] [-count N] [-error-message MSG]
+//	gomelift-local set-faults [-file rules.json]
+//	gomelift-local clear-faults
+//
+// Fault actions are delay, drop, error400, error500, close, malformed and duplicate.
+// serve also takes -faults rules.json and -fault-seed N to inject faults from the start.
+//
+// Commands other than serve talk to the control API at $GOMELIFT_LOCAL_CONTROL, or -control-url.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/neguse/gomelift/pkg/localfleet"
+	glog "github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+const defaultControlURL = "http://127.0.0.1:5758"
+
+type properties []*pbuffer.GameProperty
+
+func (p *properties) String() string {
+	var s []string
+	for _, prop := range *p {
+		s = append(s, prop.GetKey()+"="+prop.GetValue())
+	}
+	return strings.Join(s, ",")
+}
+
+func (p *properties) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("property should be KEY=VALUE: %v", v)
+	}
+	*p = append(*p, &pbuffer.GameProperty{Key: kv[0], Value: kv[1]})
+	return nil
+}
+
+type players struct {
+	ids  []string
+	data map[string]string
+}
+
+func (p *players) String() string {
+	return strings.Join(p.ids, ",")
+}
+
+func (p *players) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	p.ids = append(p.ids, kv[0])
+	if len(kv) == 2 {
+		if p.data == nil {
+			p.data = make(map[string]string)
+		}
+		p.data[kv[0]] = kv[1]
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gomelift-local <command> [flags]")
+	fmt.Fprintln(os.Stderr, "commands: serve, processes, create-game-session, game-sessions, update-game-session,")
+	fmt.Fprintln(os.Stderr, "          create-player-sessions, player-sessions, set-player-session-status, terminate-process,")
+	fmt.Fprintln(os.Stderr, "          faults, add-fault, set-faults, clear-faults")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	controlURL := os.Getenv("GOMELIFT_LOCAL_CONTROL")
+	if controlURL == "" {
+		controlURL = defaultControlURL
+	}
+	if cmd != "serve" {
+		fs.StringVar(&controlURL, "control-url", controlURL, "URL of the control API")
+	}
+	c := func() *localfleet.ControlClient {
+		return localfleet.NewControlClient(controlURL)
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch cmd {
+	case "serve":
+		auxproxyAddr := fs.String("auxproxy", "127.0.0.1:5757", "address to serve the auxproxy on")
+		controlAddr := fs.String("control", "127.0.0.1:5758", "address to serve the control API on")
+		fleetID := fs.String("fleet-id", "fleet-local", "fleet ID")
+		ipAddress := fs.String("ip-address", "127.0.0.1", "IP address of game sessions")
+		reservationTimeout := fs.Duration("reservation-timeout", time.Minute, "time until a reserved player session times out")
+		faultsFile := fs.String("faults", "", "JSON file of fault rules")
+		faultSeed := fs.Int64("fault-seed", 0, "seed of probabilistic faults, random if zero")
+		fs.Parse(args)
+		f := localfleet.NewFleet(&glog.StandardLogger{})
+		f.FleetID = *fleetID
+		f.IPAddress = *ipAddress
+		f.ReservationTimeout = *reservationTimeout
+		if *faultsFile != "" {
+			rules, err := readFaults(*faultsFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := f.SetFaults(rules); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *faultSeed != 0 {
+			f.SeedFaults(*faultSeed)
+		}
+		serve(f, *auxproxyAddr, *controlAddr)
+		return
+	case "processes":
+		fs.Parse(args)
+		result, err = c().Processes()
+	case "create-game-session":
+		var in localfleet.CreateGameSessionInput
+		var props properties
+		fs.StringVar(&in.ProcessID, "process", "", "process ID, any available process if empty")
+		fs.StringVar(&in.Name, "name", "", "game session name")
+		maxPlayers := fs.Int("max-players", 0, "maximum number of players")
+		fs.Var(&props, "property", "game property KEY=VALUE, repeatable")
+		fs.StringVar(&in.GameSessionData, "data", "", "game session data")
+		fs.StringVar(&in.MatchmakerData, "matchmaker-data", "", "matchmaker data")
+		fs.Parse(args)
+		in.MaxPlayers = int32(*maxPlayers)
+		in.GameProperties = props
+		result, err = c().CreateGameSession(&in)
+	case "game-sessions":
+		fs.Parse(args)
+		result, err = c().GameSessions()
+	case "update-game-session":
+		var in localfleet.UpdateGameSessionInput
+		var props properties
+		id := fs.String("id", "", "game session ID")
+		fs.StringVar(&in.Name, "name", "", "game session name")
+		maxPlayers := fs.Int("max-players", 0, "maximum number of players")
+		fs.Var(&props, "property", "game property KEY=VALUE, repeatable")
+		fs.StringVar(&in.MatchmakerData, "matchmaker-data", "", "matchmaker data")
+		fs.StringVar(&in.UpdateReason, "reason", "", "update reason")
+		fs.StringVar(&in.BackfillTicketID, "backfill-ticket", "", "backfill ticket ID")
+		fs.Parse(args)
+		in.MaxPlayers = int32(*maxPlayers)
+		in.GameProperties = props
+		result, err = c().UpdateGameSession(*id, &in)
+	case "create-player-sessions":
+		var ps players
+		gameSessionID := fs.String("game-session", "", "game session ID")
+		fs.Var(&ps, "player", "player ID with optional player data PLAYER[=DATA], repeatable")
+		fs.Parse(args)
+		result, err = c().CreatePlayerSessions(&localfleet.CreatePlayerSessionsInput{
+			GameSessionID: *gameSessionID,
+			PlayerIDs:     ps.ids,
+			PlayerData:    ps.data,
+		})
+	case "player-sessions":
+		var filter localfleet.PlayerSessionFilter
+		fs.StringVar(&filter.GameSessionID, "game-session", "", "game session ID")
+		fs.StringVar(&filter.PlayerID, "player", "", "player ID")
+		fs.StringVar(&filter.PlayerSessionID, "id", "", "player session ID")
+		fs.StringVar(&filter.Status, "status", "", "RESERVED, ACTIVE, COMPLETED or TIMEDOUT")
+		fs.Parse(args)
+		result, err = c().PlayerSessions(&filter)
+	case "set-player-session-status":
+		id := fs.String("id", "", "player session ID")
+		status := fs.String("status", "", "RESERVED, ACTIVE, COMPLETED or TIMEDOUT")
+		fs.Parse(args)
+		result, err = c().SetPlayerSessionStatus(*id, *status)
+	case "terminate-process":
+		id := fs.String("process", "", "process ID")
+		deadline := fs.Duration("deadline", time.Minute*5, "time until the process is terminated")
+		fs.Parse(args)
+		result, err = c().TerminateProcess(*id, time.Now().Add(*deadline))
+	case "faults":
+		fs.Parse(args)
+		result, err = c().Faults()
+	case "add-fault":
+		var rule localfleet.FaultRule
+		fs.StringVar(&rule.Message, "message", "", "message name, every message if empty")
+		action := fs.String("action", "", "delay, drop, error400, error500, close, malformed or duplicate")
+		fs.Float64Var(&rule.Probability, "probability", 1, "chance the fault fires")
+		delay := fs.Duration("delay", 0, "delay of the delay action")
+		fs.IntVar(&rule.Count, "count", 0, "how many times the fault fires, unlimited if zero")
+		fs.StringVar(&rule.ErrorMessage, "error-message", "", "error message of the error actions")
+		fs.Parse(args)
+		rule.Action = localfleet.FaultAction(*action)
+		rule.DelayMs = int64(*delay / time.Millisecond)
+		var rules []localfleet.FaultRule
+		if rules, err = c().Faults(); err == nil {
+			result, err = c().SetFaults(append(rules, rule))
+		}
+	case "set-faults":
+		file := fs.String("file", "-", "JSON file of fault rules, - for stdin")
+		fs.Parse(args)
+		var rules []localfleet.FaultRule
+		if rules, err = readFaults(*file); err == nil {
+			result, err = c().SetFaults(rules)
+		}
+	case "clear-faults":
+		fs.Parse(args)
+		result, err = c().SetFaults(nil)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(result); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readFaults(file string) ([]localfleet.FaultRule, error) {
+	r := os.Stdin
+	if file != "-" {
+		var err error
+		if r, err = os.Open(file); err != nil {
+			return nil, err
+		}
+		defer r.Close()
+	}
+	var rules []localfleet.FaultRule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func serve(f *localfleet.Fleet, auxproxyAddr string, controlAddr string) {
+	r := mux.NewRouter()
+	r.PathPrefix("/socket.io/").Handler(f.AuxProxy())
+	go func() {
+		log.Fatal(http.ListenAndServe(controlAddr, f.Control()))
+	}()
+	log.Println("auxproxy listening on", auxproxyAddr, "control API listening on", controlAddr)
+	log.Fatal(http.ListenAndServe(auxproxyAddr, r))
+}
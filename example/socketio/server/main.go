@@ -0,0 +1,35 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	glog "github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+// main serves the same events as sio.js, for example/socketio/main.go to connect to.
+func main() {
+	s := socketio.NewServer(&glog.StandardLogger{})
+	s.OnConnect(func(socket *socketio.Socket) {
+		log.Println("connection", socket.ID())
+
+		socket.SendAckFunc([]interface{}{"ccc"}, func(ack []interface{}, err error) {
+			log.Println("ccc", ack, err)
+		})
+
+		socket.On("aaa", func(data string) string {
+			log.Println(data)
+			socket.SendAckFunc([]interface{}{"fff"}, func(ack []interface{}, err error) {
+				log.Println(ack, err)
+			})
+			return "bbb"
+		})
+
+		socket.OnDisconnect(func(reason string) {
+			log.Println(reason)
+		})
+	})
+	http.Handle("/socket.io/", s)
+	log.Fatal(http.ListenAndServe(":3000", nil))
+}
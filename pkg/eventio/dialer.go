@@ -0,0 +1,124 @@
+package eventio
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrorReadLimit = errors.New("read limit exceeded")
+
+// DefaultHandshakeTimeout is the HandshakeTimeout of zero DialOptions, as of websocket.DefaultDialer.
+const DefaultHandshakeTimeout = time.Second * 45
+
+// DialOptions configures how the transports connect to the server.
+type DialOptions struct {
+	// TLSClientConfig is used for wss:// and https:// URLs. If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+	// Header is sent with the websocket handshake and the polling requests.
+	Header http.Header
+	// Jar keeps the cookies of the transports, such as those of sticky sessions set at the handshake.
+	// If nil, cookies are not sent.
+	Jar http.CookieJar
+	// Proxy returns the proxy for a request. If nil, http.ProxyFromEnvironment is used, which honors
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy func(*http.Request) (*url.URL, error)
+	// HandshakeTimeout limits the time to open the transport. Zero means DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+	// ReadLimit limits the size of a websocket message or a polling response in bytes. Zero means no limit.
+	ReadLimit int64
+	// EnableCompression negotiates permessage-deflate compression of the websocket.
+	EnableCompression bool
+}
+
+// SetDialOptions sets how the transports connect to the server. It should be called before Open.
+// The HTTP client set by SetHTTPClient takes precedence over the options for the polling transport,
+// except Header and ReadLimit.
+func (c *Client) SetDialOptions(o DialOptions) {
+	c.dialOptions = o
+	if !c.customHTTPClient {
+		c.httpClient = o.httpClient()
+	}
+}
+
+// dialer returns the websocket dialer for the options, which is websocket.DefaultDialer with the options set.
+func (o DialOptions) dialer() *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	if o.Proxy != nil {
+		d.Proxy = o.Proxy
+	}
+	d.TLSClientConfig = o.TLSClientConfig
+	d.HandshakeTimeout = o.handshakeTimeout()
+	d.Jar = o.Jar
+	d.EnableCompression = o.EnableCompression
+	return &d
+}
+
+func (o DialOptions) handshakeTimeout() time.Duration {
+	if o.HandshakeTimeout <= 0 {
+		return DefaultHandshakeTimeout
+	}
+	return o.HandshakeTimeout
+}
+
+// httpClient returns the HTTP client of the polling transport for the options.
+// It has no timeout, as a polling request waits for packets for up to the ping interval.
+func (o DialOptions) httpClient() *http.Client {
+	if o.TLSClientConfig == nil && o.Proxy == nil && o.Jar == nil {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.Proxy != nil {
+		transport.Proxy = o.Proxy
+	}
+	if o.TLSClientConfig != nil {
+		transport.TLSClientConfig = o.TLSClientConfig
+	}
+	return &http.Client{Transport: transport, Jar: o.Jar}
+}
+
+// header returns a copy of the header to send, as the websocket dialer adds its own fields.
+func (o DialOptions) header() http.Header {
+	if o.Header == nil {
+		return nil
+	}
+	h := make(http.Header, len(o.Header))
+	for k, v := range o.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	return h
+}
+
+// readAll reads r up to the read limit.
+func (o DialOptions) readAll(r io.Reader) ([]byte, error) {
+	if o.ReadLimit <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r, o.ReadLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > o.ReadLimit {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrorReadLimit, o.ReadLimit)
+	}
+	return data, nil
+}
+
+// dialWebsocket connects the websocket of url with the dial options.
+func (c *Client) dialWebsocket(url string) (*websocket.Conn, *http.Response, error) {
+	ws, resp, err := c.dialOptions.dialer().Dial(url, c.dialOptions.header())
+	if err != nil {
+		return nil, resp, err
+	}
+	if c.dialOptions.ReadLimit > 0 {
+		ws.SetReadLimit(c.dialOptions.ReadLimit)
+	}
+	return ws, resp, nil
+}
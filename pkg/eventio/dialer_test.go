@@ -0,0 +1,104 @@
+package eventio
+
+import (
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDialOptions(t *testing.T) {
+	s := newPollingServer(true)
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		cookie := ""
+		if c, err := r.Cookie("io"); err == nil {
+			cookie = c.Value
+		}
+		mu.Lock()
+		requests = append(requests, q.Get("transport")+" "+r.Header.Get("X-Token")+" "+cookie)
+		mu.Unlock()
+		if q.Get("sid") == "" {
+			http.SetCookie(w, &http.Cookie{Name: "io", Value: "sticky"})
+		}
+		s.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	c := NewClient(strings.Replace(server.URL, "https", "wss", 1)+"/engine.io/", nopLogger{})
+	c.SetTransports(TransportPolling, TransportWebsocket)
+	c.SetDialOptions(DialOptions{
+		TLSClientConfig:   server.Client().Transport.(*http.Transport).TLSClientConfig,
+		Header:            http.Header{"X-Token": {"token"}},
+		Jar:               jar,
+		HandshakeTimeout:  time.Second * 5,
+		EnableCompression: true,
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for c.Transport() != TransportWebsocket && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if c.Transport() != TransportWebsocket {
+		t.Fatal("transport mismatch", c.Transport())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests[0] != "polling token " {
+		t.Error("handshake request mismatch", requests[0])
+	}
+	upgraded := false
+	for _, r := range requests[1:] {
+		if r != "polling token sticky" && r != "websocket token sticky" {
+			t.Error("request mismatch", r)
+		}
+		upgraded = upgraded || r == "websocket token sticky"
+	}
+	if !upgraded {
+		t.Error("no upgrade request", requests)
+	}
+}
+
+func TestDialOptionsDefault(t *testing.T) {
+	isProxyFromEnvironment := func(f func(*http.Request) (*url.URL, error)) bool {
+		return f != nil && reflect.ValueOf(f).Pointer() == reflect.ValueOf(http.ProxyFromEnvironment).Pointer()
+	}
+	d := DialOptions{}.dialer()
+	if !isProxyFromEnvironment(d.Proxy) || d.HandshakeTimeout != DefaultHandshakeTimeout {
+		t.Error("zero options should keep the defaults of websocket.DefaultDialer", d.HandshakeTimeout)
+	}
+	jar, _ := cookiejar.New(nil)
+	hc := DialOptions{Jar: jar}.httpClient()
+	if !isProxyFromEnvironment(hc.Transport.(*http.Transport).Proxy) {
+		t.Error("polling should keep the proxy of the environment")
+	}
+}
+
+func TestDialOptionsReadLimit(t *testing.T) {
+	server := httptest.NewServer(newPollingServer(false))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	c.SetTransports(TransportPolling)
+	c.SetDialOptions(DialOptions{ReadLimit: 16})
+	if err := c.Open(); !errors.Is(err, ErrorReadLimit) {
+		c.Close()
+		t.Fatal("error mismatch", err)
+	}
+}
@@ -1,6 +1,7 @@
 package eventio
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,8 +24,26 @@ type OpenResponse struct {
 	Upgrades     []string `json:"upgrades"`
 	PingInterval int      `json:"pingInterval"`
 	PingTimeout  int      `json:"pingTimeout"`
+	// MaxPayload is the maximum number of bytes of a polling payload, sent by some Protocol4 servers.
+	MaxPayload int `json:"maxPayload,omitempty"`
 }
 
+// Protocol is a revision of the Engine.IO protocol, sent as the EIO query parameter.
+type Protocol int
+
+const (
+	// ProtocolAuto tries Protocol3, and Protocol4 if the server refuses it as unsupported.
+	ProtocolAuto Protocol = 0
+	// Protocol3 is used by socket.io v2. The client sends pings.
+	Protocol3 Protocol = 3
+	// Protocol4 is used by socket.io v3 and later. The server sends pings,
+	// and binary websocket frames carry the message without the packet type.
+	Protocol4 Protocol = 4
+)
+
+// RecordSeparator separates the packets of a polling payload in Protocol4.
+const RecordSeparator = "\x1e"
+
 type PacketType int
 
 func (pt PacketType) String() string {
@@ -60,13 +80,30 @@ const (
 type Packet struct {
 	Type PacketType
 	Data string
+	// Binary reports whether Data is binary, carried by a binary websocket frame or base64 encoded.
+	Binary bool `json:",omitempty"`
 }
 
 var (
 	ErrorEmptyPacket     = errors.New("Packet length should be at least 1 byte")
+	ErrorBinaryPacket    = errors.New("Packet should be binary")
 	ErrorHttpStatusNotOk = errors.New("HTTP Status Not OK")
+	ErrorInvalidPacket   = errors.New("Packet is malformed")
+	ErrorInvalidPayload  = errors.New("Payload is malformed")
+	// ErrorUnsupportedProtocol is returned by Open if the server refuses the protocol version.
+	ErrorUnsupportedProtocol = errors.New("unsupported protocol version")
+	// ErrorHandshake is returned by Open if the server does not answer the handshake with an open packet.
+	ErrorHandshake = errors.New("handshake failed")
 )
 
+// parseType parses the packet type of the first byte of a text packet.
+func parseType(ch byte) (PacketType, error) {
+	if ch < '0' || ch > '0'+byte(Noop) {
+		return 0, fmt.Errorf("%w: unknown packet type %q", ErrorInvalidPacket, ch)
+	}
+	return PacketType(ch - '0'), nil
+}
+
 func ParsePacket(packet string) (Packet, error) {
 	b64 := false
 	if len(packet) == 0 {
@@ -75,64 +112,222 @@ func ParsePacket(packet string) (Packet, error) {
 	if packet[0] == 'b' {
 		b64 = true
 		packet = packet[1:]
+		if len(packet) == 0 {
+			return Packet{}, ErrorEmptyPacket
+		}
 	}
-	t, err := strconv.Atoi(packet[0:1])
+	t, err := parseType(packet[0])
 	if err != nil {
 		return Packet{}, err
 	}
-	var data string
+	data := packet[1:]
 	if b64 {
-		datab, err := base64.StdEncoding.DecodeString(packet[1:len(packet)])
+		datab, err := base64.StdEncoding.DecodeString(data)
 		if err != nil {
 			return Packet{}, err
 		}
 		data = string(datab)
-	} else {
-		data = packet[1:len(packet)]
 	}
 	return Packet{
-		Type: PacketType(t),
-		Data: data,
+		Type:   t,
+		Data:   data,
+		Binary: b64,
 	}, nil
 }
 
+// ParseBinaryFrame parses a binary websocket frame, whose first byte is the packet type.
+func ParseBinaryFrame(frame []byte) (Packet, error) {
+	if len(frame) == 0 {
+		return Packet{}, ErrorEmptyPacket
+	}
+	if PacketType(frame[0]) > Noop {
+		return Packet{}, fmt.Errorf("%w: unknown packet type %d", ErrorInvalidPacket, frame[0])
+	}
+	return Packet{Type: PacketType(frame[0]), Data: string(frame[1:]), Binary: true}, nil
+}
+
+// EncodeBinaryFrame encodes a binary packet into a binary websocket frame.
+func EncodeBinaryFrame(p Packet) ([]byte, error) {
+	if !p.Binary {
+		return nil, ErrorBinaryPacket
+	}
+	return append([]byte{byte(p.Type)}, p.Data...), nil
+}
+
+// EncodeBase64Packet encodes a binary packet into the base64 form "b<type><base64>".
+func EncodeBase64Packet(p Packet) (string, error) {
+	if !p.Binary {
+		return "", ErrorBinaryPacket
+	}
+	return string(appendBase64Packet(nil, p)), nil
+}
+
+func appendBase64Packet(buf []byte, p Packet) []byte {
+	buf = append(buf, 'b')
+	buf = strconv.AppendInt(buf, int64(p.Type), 10)
+	return appendBase64(buf, p.Data)
+}
+
+func appendBase64(buf []byte, data string) []byte {
+	n := len(buf)
+	size := base64.StdEncoding.EncodedLen(len(data))
+	if cap(buf)-n < size {
+		grown := make([]byte, n, n+size)
+		copy(grown, buf)
+		buf = grown
+	}
+	buf = buf[:n+size]
+	base64.StdEncoding.Encode(buf[n:], []byte(data))
+	return buf
+}
+
 func EncodePacket(p Packet) ([]byte, error) {
-	s := fmt.Sprintf("%d%v", p.Type, p.Data)
-	return []byte(s), nil
+	return appendPacket(make([]byte, 0, len(p.Data)+1), p), nil
+}
+
+func appendPacket(buf []byte, p Packet) []byte {
+	buf = strconv.AppendInt(buf, int64(p.Type), 10)
+	return append(buf, p.Data...)
+}
+
+// utf16Len returns the length of s in UTF-16 code units, which the payloads of Protocol3 are measured in.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// utf16Prefix returns the number of bytes of the first n UTF-16 code units of s.
+// It reports false if s is shorter or the n-th unit splits a surrogate pair.
+func utf16Prefix(s string, n int) (int, bool) {
+	units := 0
+	for i, r := range s {
+		if units == n {
+			return i, true
+		}
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		if units > n {
+			return 0, false
+		}
+	}
+	return len(s), units == n
 }
 
+// parseLength parses the length prefix of a packet in a payload of Protocol3.
+func parseLength(s string) (int, bool) {
+	if len(s) == 0 || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+// ParsePayloads parses a polling payload of Protocol3, a sequence of "<length>:<packet>" where the length
+// counts the UTF-16 code units of the packet.
 func ParsePayloads(data string) ([]Packet, error) {
 	var packets []Packet
 	for len(data) > 0 {
-
-		var p Packet
-		n := strings.Index(data, ":")
-		var (
-			err error
-			l   int
-		)
-		if l, err = strconv.Atoi(data[:n]); err != nil {
-			return nil, err
+		n := strings.IndexByte(data, ':')
+		if n < 0 {
+			return nil, fmt.Errorf("%w: missing length", ErrorInvalidPayload)
+		}
+		l, ok := parseLength(data[:n])
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid length %q", ErrorInvalidPayload, data[:n])
+		}
+		data = data[n+1:]
+		size, ok := utf16Prefix(data, l)
+		if !ok {
+			return nil, fmt.Errorf("%w: length %d beyond the payload", ErrorInvalidPayload, l)
 		}
-		p, err = ParsePacket(data[n+1 : n+1+l])
+		p, err := ParsePacket(data[:size])
 		if err != nil {
 			return nil, err
 		}
-		data = data[n+1+l : len(data)]
+		data = data[size:]
 		packets = append(packets, p)
 	}
 	return packets, nil
 }
 
 func EncodePayloads(packets []Packet) ([]byte, error) {
-	var buf []byte
+	var buf, p []byte
 	for _, packet := range packets {
-		p, err := EncodePacket(packet)
-		if err != nil {
-			return nil, err
+		if packet.Binary {
+			// the polling transport carries binary packets in base64
+			p = appendBase64Packet(p[:0], packet)
+		} else {
+			p = appendPacket(p[:0], packet)
+		}
+		buf = strconv.AppendInt(buf, int64(utf16Len(string(p))), 10)
+		buf = append(buf, ':')
+		buf = append(buf, p...)
+	}
+	return buf, nil
+}
+
+// ParsePayloadsV4 parses a polling payload of Protocol4, whose packets are separated by RecordSeparator.
+// Binary packets are messages in the form "b<base64>".
+func ParsePayloadsV4(data string) ([]Packet, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	packets := make([]Packet, 0, strings.Count(data, RecordSeparator)+1)
+	for {
+		s := data
+		n := strings.Index(data, RecordSeparator)
+		if n >= 0 {
+			s = data[:n]
+		}
+		if strings.HasPrefix(s, "b") {
+			b, err := base64.StdEncoding.DecodeString(s[1:])
+			if err != nil {
+				return nil, err
+			}
+			packets = append(packets, Packet{Type: Message, Data: string(b), Binary: true})
+		} else {
+			p, err := ParsePacket(s)
+			if err != nil {
+				return nil, err
+			}
+			packets = append(packets, p)
+		}
+		if n < 0 {
+			return packets, nil
+		}
+		data = data[n+len(RecordSeparator):]
+	}
+}
+
+// EncodePayloadsV4 encodes packets into a polling payload of Protocol4.
+func EncodePayloadsV4(packets []Packet) ([]byte, error) {
+	var buf []byte
+	for i, packet := range packets {
+		if i > 0 {
+			buf = append(buf, RecordSeparator...)
+		}
+		if packet.Binary {
+			buf = append(buf, 'b')
+			buf = appendBase64(buf, packet.Data)
+			continue
 		}
-		s := fmt.Sprintf("%d:%s", len(p), p)
-		buf = append(buf, []byte(s)...)
+		buf = appendPacket(buf, packet)
 	}
 	return buf, nil
 }
@@ -149,10 +344,60 @@ func ParseResponse(resp *http.Response) ([]Packet, error) {
 	return ParsePayloads(string(data))
 }
 
+// Direction is the direction of a frame as seen from the client.
+type Direction int
+
+const (
+	Inbound Direction = iota
+	Outbound
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Inbound:
+		return "Inbound"
+	case Outbound:
+		return "Outbound"
+	default:
+		return "Unknown"
+	}
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Direction) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "Inbound":
+		*d = Inbound
+	case "Outbound":
+		*d = Outbound
+	default:
+		return fmt.Errorf("unknown direction %q", text)
+	}
+	return nil
+}
+
+// FrameHook observes every raw frame read from or written to the connection.
+// Binary frames are passed in the base64 form of EncodeBase64Packet.
+type FrameHook func(dir Direction, frame string)
+
 type Handler interface {
 	HandleMessage(msg string)
 }
 
+// CloseHandler is implemented by Handlers notified when the connection is closed.
+// err is the read error that closed it, or nil if Close was called.
+type CloseHandler interface {
+	HandleClose(err error)
+}
+
+// BinaryHandler is implemented by Handlers receiving binary messages.
+type BinaryHandler interface {
+	HandleBinaryMessage(data []byte)
+}
+
 type nullHandler struct{}
 
 func (h nullHandler) HandleMessage(msg string) {
@@ -161,43 +406,124 @@ func (h nullHandler) HandleMessage(msg string) {
 type Client struct {
 	url          string
 	sid          string
+	protocol     Protocol
 	pingInterval int
 	pingTimeout  int
+	maxPayload   int
 	upgrades     []string
 	sendCh       chan Packet
+	// controlCh queues the packets of the protocol, and flushCh passes the flush requests of Close to loop.
+	controlCh    chan Packet
+	flushCh      chan chan error
+	queueOptions QueueOptions
 	handler      Handler
+	frameHook    FrameHook
 	c            *websocket.Conn
 	logger       log.Logger
+
+	transports  []string
+	dialOptions DialOptions
+	httpClient  *http.Client
+	// customHTTPClient reports whether httpClient is set by SetHTTPClient.
+	customHTTPClient bool
+	// polling reports whether the transport is polling, guarded by mu.
+	polling bool
+	// upgradeCh passes the probed websocket to loop. pollStop stops polling for the upgrade, and
+	// pollStopped is closed when polling stops.
+	upgradeCh   chan *websocket.Conn
+	pollStop    chan struct{}
+	pollStopped chan struct{}
+	// ctx is canceled on shutdown to abort polling requests.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	connected bool
+	// looping reports whether loop is started, and queueStats is the statistics of sendCh.
+	looping    bool
+	queueStats QueueStats
+	// pingSentAt is the time the ping waiting for its pong was sent, and rtt is the last round-trip time.
+	pingSentAt time.Time
+	rtt        time.Duration
+	// heartbeat notifies loop of heartbeats from the server.
+	heartbeat chan struct{}
+	lifecycle func(e LifecycleEvent)
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewClient(url string, logger log.Logger) *Client {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		url:     url,
-		sendCh:  make(chan Packet, 100),
-		handler: nullHandler{},
-		logger:  logger,
+		url:       url,
+		sendCh:    make(chan Packet, DefaultQueueSize),
+		controlCh: make(chan Packet, 4),
+		flushCh:   make(chan chan error),
+		queueOptions: QueueOptions{
+			Size:         DefaultQueueSize,
+			FlushTimeout: DefaultFlushTimeout,
+		},
+		handler:    nullHandler{},
+		logger:     logger,
+		done:       make(chan struct{}),
+		transports: []string{TransportWebsocket},
+		httpClient: http.DefaultClient,
+		upgradeCh:  make(chan *websocket.Conn),
+		heartbeat:  make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 }
 
+// SetProtocol selects the protocol version. It should be called before Open. The default is ProtocolAuto.
+func (c *Client) SetProtocol(p Protocol) {
+	c.protocol = p
+}
+
+// Protocol returns the protocol version, which is negotiated by Open if ProtocolAuto is selected.
+func (c *Client) Protocol() Protocol {
+	return c.protocol
+}
+
+// MaxPayload returns the maximum payload size sent by the server, or 0 if unknown.
+func (c *Client) MaxPayload() int {
+	return c.maxPayload
+}
+
+// FullUrl returns the URL of the websocket transport, or "" if the URL of the client is invalid.
 func (c *Client) FullUrl() string {
+	u, _ := c.transportURL(TransportWebsocket)
+	return u
+}
+
+func (c *Client) transportURL(transport string) (string, error) {
 	u, err := url.Parse(c.url)
 	if err != nil {
-		c.logger.Panic("failed to parse", err)
+		return "", err
 	}
 	v := u.Query()
-	v.Add("transport", "websocket")
-	v.Add("b64", "1")
+	v.Add("transport", transport)
+	switch c.protocol {
+	case Protocol3:
+		v.Set("EIO", "3")
+		v.Add("b64", "1")
+	case Protocol4:
+		v.Set("EIO", "4")
+	default:
+		v.Add("b64", "1")
+	}
 	if c.sid != "" {
 		v.Add("sid", c.sid)
 	}
 	u.RawQuery = v.Encode()
-	return u.String()
+	return u.String(), nil
 }
 
 func (c *Client) HandleOpen(r OpenResponse) error {
 	c.sid = r.Sid
 	c.pingInterval = r.PingInterval
 	c.pingTimeout = r.PingTimeout
+	c.maxPayload = r.MaxPayload
 	c.upgrades = r.Upgrades
 	return nil
 }
@@ -207,10 +533,27 @@ func (c *Client) poll() error {
 	if err != nil {
 		return err
 	}
-	if typ != websocket.TextMessage {
-		c.logger.Panic("unsupported message type", typ)
+	var packet Packet
+	switch typ {
+	case websocket.TextMessage:
+		if c.frameHook != nil {
+			c.frameHook(Inbound, string(data))
+		}
+		packet, err = ParsePacket(string(data))
+	case websocket.BinaryMessage:
+		if c.protocol == Protocol4 {
+			packet = Packet{Type: Message, Data: string(data), Binary: true}
+		} else {
+			packet, err = ParseBinaryFrame(data)
+		}
+		if err == nil && c.frameHook != nil {
+			s, _ := EncodeBase64Packet(packet)
+			c.frameHook(Inbound, s)
+		}
+	default:
+		c.logger.Log("unsupported message type", typ)
+		return nil
 	}
-	packet, err := ParsePacket(string(data))
 	if err != nil {
 		return err
 	}
@@ -224,51 +567,85 @@ func (c *Client) poll() error {
 
 func (c *Client) loop() error {
 	f := func() error {
-		pingTick := time.NewTicker(time.Millisecond * time.Duration(c.pingInterval))
+		// the server sends pings in Protocol4
+		var pingCh <-chan time.Time
+		if c.protocol != Protocol4 {
+			pingTick := time.NewTicker(time.Millisecond * time.Duration(c.pingInterval))
+			defer pingTick.Stop()
+			pingCh = pingTick.C
+		}
+		hb := c.newHeartbeatTimer()
+		defer hb.stop()
 		for {
 			select {
-			case <-pingTick.C:
-				c.sendPing("probe")
+			case <-c.done:
+				return nil
+			case <-pingCh:
+				c.ping()
+				hb.pinged()
+
+			case <-c.heartbeat:
+				hb.beat()
+
+			case <-hb.C():
+				c.logger.Log("no heartbeat from the server, closing")
+				c.shutdown(ErrorPingTimeout)
+				c.closeTransport()
+				return nil
+
+			case ws := <-c.upgradeCh:
+				if err := c.upgrade(ws); err != nil {
+					return err
+				}
 
-			case p := <-c.sendCh:
-				c.logger.Log("sending", p.Type)
-				data, err := EncodePacket(p)
+			case reply := <-c.flushCh:
+				err := c.flush()
+				if err == nil && c.Transport() == TransportWebsocket {
+					// Close posts the close packet itself when polling
+					err = c.write(Packet{Type: Close})
+				}
+				reply <- err
 				if err != nil {
 					return err
 				}
-				{
-					err := func() error {
-						err := c.c.WriteMessage(websocket.TextMessage, data)
-						if err != nil {
-							return err
-						}
-						return nil
-					}()
-					if err != nil {
-						return err
-					}
+
+			case p := <-c.controlCh:
+				if err := c.write(p); err != nil {
+					return err
+				}
+
+			case p := <-c.sendCh:
+				if err := c.write(p); err != nil {
+					return err
 				}
 			}
 		}
-		return nil
 	}
 	if err := f(); err != nil {
-		c.logger.Panic("error occurred in eventio.Client.loop()", err)
+		select {
+		case <-c.done:
+			// the connection was closed while writing
+			return nil
+		default:
+		}
+		c.logger.Log("error occurred in eventio.Client.loop()", err)
+		c.shutdown(err)
+		c.closeTransport()
 		return err
 	}
 	return nil
 }
 
-func (c *Client) sendPacket(p Packet) {
-	c.sendCh <- p
+func (c *Client) sendPacket(p Packet) error {
+	return c.enqueue(p)
 }
 
-func (c *Client) SendMessage(m string) {
+func (c *Client) SendMessage(m string) error {
 	p := Packet{
 		Type: Message,
 		Data: m,
 	}
-	c.sendPacket(p)
+	return c.sendPacket(p)
 }
 
 func (c *Client) sendPing(m string) {
@@ -276,7 +653,7 @@ func (c *Client) sendPing(m string) {
 		Type: Ping,
 		Data: m,
 	}
-	c.sendPacket(p)
+	c.sendControl(p)
 }
 
 func (c *Client) HandlePacket(p Packet) error {
@@ -285,14 +662,25 @@ func (c *Client) HandlePacket(p Packet) error {
 	case Open:
 		var r OpenResponse
 		if err := json.Unmarshal([]byte(p.Data), &r); err != nil {
-			c.logger.Panic("error occurrend in eventio.Client.HandlePacket()", err)
+			return err
 		}
 		return c.HandleOpen(r)
 	case Close:
 	case Ping:
+		if c.protocol == Protocol4 {
+			c.beat(p)
+			c.sendControl(Packet{Type: Pong, Data: p.Data})
+		}
 	case Pong:
+		c.beat(p)
 	case Message:
-		c.handler.HandleMessage(p.Data)
+		if !p.Binary {
+			c.handler.HandleMessage(p.Data)
+		} else if bh, ok := c.handler.(BinaryHandler); ok {
+			bh.HandleBinaryMessage([]byte(p.Data))
+		} else {
+			c.logger.Log("binary message is not handled")
+		}
 		return nil
 	case Upgrade:
 	case Noop:
@@ -300,35 +688,178 @@ func (c *Client) HandlePacket(p Packet) error {
 	return nil
 }
 
-func (c *Client) Open() error {
-	wsConn, _, err := websocket.DefaultDialer.Dial(c.FullUrl(), nil)
+// dial connects the websocket. ErrorUnsupportedProtocol is returned if the server refuses the protocol version.
+func (c *Client) dial() (*websocket.Conn, error) {
+	u, err := c.transportURL(TransportWebsocket)
+	if err != nil {
+		return nil, err
+	}
+	wsConn, resp, err := c.dialWebsocket(u)
+	if err == websocket.ErrBadHandshake && resp != nil && resp.StatusCode == http.StatusBadRequest {
+		var e struct {
+			Code int `json:"code"`
+		}
+		if data, rerr := ioutil.ReadAll(resp.Body); rerr == nil && json.Unmarshal(data, &e) == nil && e.Code == 5 {
+			return nil, ErrorUnsupportedProtocol
+		}
+	}
+	return wsConn, err
+}
+
+// negotiate calls open with Protocol3, and Protocol4 if the server refuses it, when ProtocolAuto is selected.
+func (c *Client) negotiate(open func() error) error {
+	auto := c.protocol == ProtocolAuto
+	if auto {
+		c.protocol = Protocol3
+	}
+	err := open()
+	if err == ErrorUnsupportedProtocol && auto {
+		c.logger.Log("falling back to protocol", Protocol4)
+		c.protocol = Protocol4
+		err = open()
+	}
+	if err != nil && auto {
+		c.protocol = ProtocolAuto
+	}
+	return err
+}
+
+// openWebsocket opens the websocket transport and reads the open packet.
+func (c *Client) openWebsocket() error {
+	wsConn, err := c.dial()
 	if err != nil {
 		return err
 	}
 	c.c = wsConn
+	c.setConnected(true)
 
 	err = c.poll()
+	if err == nil && c.sid == "" {
+		err = fmt.Errorf("%w: no open packet", ErrorHandshake)
+	}
 	if err != nil {
 		c.logger.Log("error occurred in eventio.Client.Open()", err)
+		c.setConnected(false)
+		wsConn.Close()
+		return err
 	}
+	c.emit(LifecycleEvent{Type: LifecycleConnected, SID: c.sid})
+	go c.readWebsocket()
+	return nil
+}
 
-	go func() {
-		for {
-			err := c.poll()
-			if err != nil {
-				c.logger.Log("error occurred in eventio.Client.Open()", err)
-			}
+func (c *Client) readWebsocket() {
+	for {
+		err := c.poll()
+		if err != nil {
+			c.logger.Log("error occurred in eventio.Client.Open()", err)
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+// Open opens the connection with the transports set by SetTransports.
+func (c *Client) Open() error {
+	if len(c.transports) == 0 {
+		c.transports = []string{TransportWebsocket}
+	}
+	var err error
+	if c.transports[0] == TransportPolling {
+		err = c.negotiate(c.openPolling)
+	} else {
+		err = c.negotiate(c.openWebsocket)
+		if err != nil && c.allows(TransportPolling) {
+			c.logger.Log("failed to open websocket, falling back to polling", err)
+			err = c.negotiate(c.openPolling)
 		}
-	}()
+	}
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.looping = true
+	c.mu.Unlock()
 	go c.loop()
+	if c.Transport() == TransportPolling && c.allows(TransportWebsocket) {
+		for _, u := range c.upgrades {
+			if u == TransportWebsocket {
+				go c.probe()
+				break
+			}
+		}
+	}
 	return nil
 }
 
-func (c *Client) Send(msg string) {
+// Send queues a message to send. The error depends on the policy set by SetQueueOptions,
+// and ErrorClosed is returned after the client is closed.
+func (c *Client) Send(msg string) error {
 	p := Packet{Type: Message, Data: msg}
-	c.sendCh <- p
+	return c.sendPacket(p)
+}
+
+// SendBinary queues a binary message to send. See Send.
+func (c *Client) SendBinary(data []byte) error {
+	p := Packet{Type: Message, Data: string(data), Binary: true}
+	return c.sendPacket(p)
 }
 
 func (c *Client) Handle(h Handler) {
 	c.handler = h
 }
+
+// HookFrame sets h to observe raw frames. It should be called before Open.
+func (c *Client) HookFrame(h FrameHook) {
+	c.frameHook = h
+}
+
+// shutdown marks the client closed and notifies the handler, only for the first time.
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.cancel()
+		c.setConnected(false)
+		if ch, ok := c.handler.(CloseHandler); ok {
+			ch.HandleClose(err)
+		}
+		c.emit(LifecycleEvent{Type: LifecycleDisconnected, Reason: DisconnectReason(err), Err: err})
+	})
+}
+
+func (c *Client) setConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = connected
+}
+
+// Connected reports whether the websocket is open.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Close closes the connection after writing the queued packets, waiting for them up to the
+// flush timeout set by SetQueueOptions. Packets not written by then are discarded.
+func (c *Client) Close() error {
+	c.requestFlush()
+	if c.Transport() == TransportPolling && c.Connected() {
+		if err := c.post([]Packet{{Type: Close}}); err != nil {
+			c.logger.Log("failed to send close", err)
+		}
+	}
+	c.shutdown(nil)
+	return c.closeTransport()
+}
+
+// closeTransport closes the websocket, if any. Polling requests are aborted by shutdown.
+func (c *Client) closeTransport() error {
+	c.mu.Lock()
+	ws := c.c
+	c.mu.Unlock()
+	if ws == nil {
+		return nil
+	}
+	return ws.Close()
+}
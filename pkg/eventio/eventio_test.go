@@ -1,10 +1,36 @@
 package eventio
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
+type nopLogger struct{}
+
+func (l nopLogger) Log(msg string, args ...interface{}) {}
+
+func (l nopLogger) Panic(msg string, args ...interface{}) {
+	panic(fmt.Sprint(msg, args))
+}
+
+type chanHandler chan string
+
+func (h chanHandler) HandleMessage(msg string) {
+	h <- msg
+}
+
+func (h chanHandler) HandleBinaryMessage(data []byte) {
+	h <- fmt.Sprintf("binary %v", data)
+}
+
 func TestEncode(t *testing.T) {
 	p := Packet{Type: Message, Data: "data"}
 	enc, err := EncodePacket(p)
@@ -16,3 +42,216 @@ func TestEncode(t *testing.T) {
 		t.Error("data mismatch", enc, expect)
 	}
 }
+
+func TestBinary(t *testing.T) {
+	p, err := ParseBinaryFrame([]byte{4, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != Message || p.Data != "\x01\x02\x03" || !p.Binary {
+		t.Error("packet mismatch", p)
+	}
+	frame, err := EncodeBinaryFrame(p)
+	if err != nil || !reflect.DeepEqual(frame, []byte{4, 1, 2, 3}) {
+		t.Error("frame mismatch", frame, err)
+	}
+	s, err := EncodeBase64Packet(p)
+	if err != nil || s != "b4AQID" {
+		t.Error("base64 mismatch", s, err)
+	}
+	q, err := ParsePacket(s)
+	if err != nil || !reflect.DeepEqual(p, q) {
+		t.Error("base64 packet mismatch", q, err)
+	}
+	if _, err := EncodeBinaryFrame(Packet{Type: Message, Data: "text"}); err != ErrorBinaryPacket {
+		t.Error("text packet should not be encoded as binary", err)
+	}
+}
+
+func TestPayloadsV4(t *testing.T) {
+	packets := []Packet{
+		{Type: Message, Data: "hello"},
+		{Type: Message, Data: "\x01\x02\x03", Binary: true},
+		{Type: Ping},
+	}
+	data, err := EncodePayloadsV4(packets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4hello\x1ebAQID\x1e2" {
+		t.Errorf("payload mismatch %q", data)
+	}
+	decoded, err := ParsePayloadsV4(string(data))
+	if err != nil || !reflect.DeepEqual(decoded, packets) {
+		t.Error("packets mismatch", decoded, err)
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	packets := []Packet{
+		{Type: Message, Data: "héllo 😀"},
+		{Type: Message, Data: "\x01\x02\x03", Binary: true},
+		{Type: Ping},
+	}
+	data, err := EncodePayloads(packets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lengths count UTF-16 code units
+	if string(data) != "9:4héllo 😀6:b4AQID1:2" {
+		t.Errorf("payload mismatch %q", data)
+	}
+	decoded, err := ParsePayloads(string(data))
+	if err != nil || !reflect.DeepEqual(decoded, packets) {
+		t.Error("packets mismatch", decoded, err)
+	}
+
+	for _, s := range []string{"4hello", "x:4", ":4", "-1:4", "10:4hello", "2:4😀", "0:", "1:b", "1:9", "99999999999999999999:4"} {
+		if _, err := ParsePayloads(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+}
+
+func TestOpenMalformed(t *testing.T) {
+	for _, first := range []string{`0{"sid":`, `4message`} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var upgrader websocket.Upgrader
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.WriteMessage(websocket.TextMessage, []byte(first))
+			conn.ReadMessage()
+		}))
+
+		c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+		c.SetProtocol(Protocol3)
+		var events []LifecycleEvent
+		c.OnLifecycle(func(e LifecycleEvent) {
+			events = append(events, e)
+		})
+		err := c.Open()
+		if err == nil {
+			t.Error("malformed handshake should fail Open", first)
+		} else if first == `4message` && !errors.Is(err, ErrorHandshake) {
+			t.Error("error mismatch", err)
+		}
+		if len(events) != 0 || c.Connected() {
+			t.Error("client should not be connected", first, events)
+		}
+		server.Close()
+	}
+}
+
+func TestProtocolNegotiation(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("EIO") != "4" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":5,"message":"Unsupported protocol version"}`))
+			return
+		}
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":10,"pingTimeout":20000,"maxPayload":1000000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`2`))
+		conn.WriteMessage(websocket.BinaryMessage, []byte{1, 2})
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if typ == websocket.BinaryMessage {
+				recv <- fmt.Sprintf("binary %v", data)
+			} else {
+				recv <- string(data)
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	h := make(chanHandler, 10)
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Protocol() != Protocol4 || c.MaxPayload() != 1000000 {
+		t.Error("protocol mismatch", c.Protocol(), c.MaxPayload())
+	}
+	c.SendBinary([]byte{3})
+
+	// the client answers the ping and does not send its own pings even with a short pingInterval
+	frames := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-recv:
+			frames[s] = true
+		case <-time.After(time.Second * 5):
+			t.Fatal("no frame from the client")
+		}
+	}
+	if !frames["3"] || !frames["binary [3]"] {
+		t.Error("frames mismatch", frames)
+	}
+	select {
+	case s := <-h:
+		if s != "binary [1 2]" {
+			t.Error("binary message mismatch", s)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("binary message is not handled")
+	}
+	select {
+	case s := <-recv:
+		t.Error("unexpected frame", s)
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	c3 := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	c3.SetProtocol(Protocol3)
+	if err := c3.Open(); err != ErrorUnsupportedProtocol {
+		t.Error("Protocol3 should be refused", err)
+	}
+}
+
+func BenchmarkParsePayloads(b *testing.B) {
+	data := "6:4hello6:b4AQID1:2"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePayloads(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodePayloads(b *testing.B) {
+	packets := []Packet{
+		{Type: Message, Data: "hello"},
+		{Type: Message, Data: "\x01\x02\x03", Binary: true},
+		{Type: Ping},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodePayloads(packets); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParsePayloadsV4(b *testing.B) {
+	data := "4hello\x1ebAQID\x1e2"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePayloadsV4(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.18
+// +build go1.18
+
+package eventio
+
+import (
+	"reflect"
+	"testing"
+)
+
+// FuzzParsePayloads checks that ParsePayloads does not panic, and that parsed packets survive a round trip.
+func FuzzParsePayloads(f *testing.F) {
+	for _, s := range []string{"6:4hello6:b4AQID1:2", "9:4héllo 😀", "1:6", "2:4:"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		packets, err := ParsePayloads(s)
+		if err != nil {
+			return
+		}
+		data, err := EncodePayloads(packets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ParsePayloads(string(data))
+		if err != nil || !reflect.DeepEqual(decoded, packets) {
+			t.Fatalf("round trip mismatch of %q: %v, expected %v: %v", data, decoded, packets, err)
+		}
+	})
+}
+
+// FuzzParsePayloadsV4 checks that ParsePayloadsV4 does not panic, and that parsed packets survive a round trip.
+func FuzzParsePayloadsV4(f *testing.F) {
+	for _, s := range []string{"4hello\x1ebAQID\x1e2", "6", "b"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		packets, err := ParsePayloadsV4(s)
+		if err != nil {
+			return
+		}
+		data, err := EncodePayloadsV4(packets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ParsePayloadsV4(string(data))
+		if err != nil || !reflect.DeepEqual(decoded, packets) {
+			t.Fatalf("round trip mismatch of %q: %v, expected %v: %v", data, decoded, packets, err)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package eventio
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorPingTimeout is passed to CloseHandler when the connection is closed for missing heartbeats.
+var ErrorPingTimeout = errors.New("ping timeout")
+
+// RTT returns the round-trip time measured by the last ping and pong, or 0 if not measured yet.
+// It is measured only in Protocol3, where the client sends pings.
+func (c *Client) RTT() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rtt
+}
+
+// beat notifies loop of a heartbeat from the server, which is a pong in Protocol3 and a ping in Protocol4.
+func (c *Client) beat(p Packet) {
+	if p.Type == Pong && p.Data == "probe" {
+		c.mu.Lock()
+		if !c.pingSentAt.IsZero() {
+			c.rtt = time.Since(c.pingSentAt)
+			c.pingSentAt = time.Time{}
+		}
+		c.mu.Unlock()
+	}
+	select {
+	case c.heartbeat <- struct{}{}:
+	default:
+	}
+}
+
+// ping sends a ping and records the time to measure RTT.
+func (c *Client) ping() {
+	c.mu.Lock()
+	c.pingSentAt = time.Now()
+	c.mu.Unlock()
+	c.sendPing("probe")
+}
+
+// heartbeatTimer tracks the liveness of the connection for loop.
+// In Protocol3, it waits pingTimeout for the pong after each ping.
+// In Protocol4, it waits pingInterval+pingTimeout for the next ping from the server.
+type heartbeatTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+	v4      bool
+}
+
+func (c *Client) newHeartbeatTimer() *heartbeatTimer {
+	h := &heartbeatTimer{v4: c.protocol == Protocol4}
+	if c.pingTimeout <= 0 {
+		return h
+	}
+	h.timeout = time.Millisecond * time.Duration(c.pingTimeout)
+	if h.v4 {
+		h.timeout += time.Millisecond * time.Duration(c.pingInterval)
+		h.timer = time.NewTimer(h.timeout)
+	}
+	return h
+}
+
+// C returns the channel notified when the connection is considered dead, or nil if not armed.
+func (h *heartbeatTimer) C() <-chan time.Time {
+	if h.timer == nil {
+		return nil
+	}
+	return h.timer.C
+}
+
+// pinged arms the timer after a ping in Protocol3, unless it is waiting for the previous pong.
+func (h *heartbeatTimer) pinged() {
+	if h.v4 || h.timeout <= 0 || h.timer != nil {
+		return
+	}
+	h.timer = time.NewTimer(h.timeout)
+}
+
+// beat handles a heartbeat from the server.
+func (h *heartbeatTimer) beat() {
+	if h.timer == nil {
+		return
+	}
+	if !h.timer.Stop() {
+		select {
+		case <-h.timer.C:
+		default:
+		}
+	}
+	if h.v4 {
+		h.timer.Reset(h.timeout)
+	} else {
+		h.timer = nil
+	}
+}
+
+func (h *heartbeatTimer) stop() {
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+}
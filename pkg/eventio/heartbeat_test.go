@@ -0,0 +1,94 @@
+package eventio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type closeHandler struct {
+	nullHandler
+	closed chan error
+}
+
+func (h closeHandler) HandleClose(err error) {
+	h.closed <- err
+}
+
+func TestPingTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		eio  string
+	}{
+		{"protocol 3", "3"},
+		{"protocol 4", "4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the server answers pings until mute is set
+			var mute int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var upgrader websocket.Upgrader
+				conn, err := upgrader.Upgrade(w, r, nil)
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":20,"pingTimeout":100}`))
+				if test.eio == "4" {
+					conn.WriteMessage(websocket.TextMessage, []byte(`2`))
+				}
+				for {
+					_, data, err := conn.ReadMessage()
+					if err != nil {
+						return
+					}
+					if string(data) == "2probe" && atomic.LoadInt32(&mute) == 0 {
+						conn.WriteMessage(websocket.TextMessage, []byte("3probe"))
+					}
+				}
+			}))
+			defer server.Close()
+
+			c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/?EIO="+test.eio, nopLogger{})
+			if test.eio == "4" {
+				c.SetProtocol(Protocol4)
+			} else {
+				c.SetProtocol(Protocol3)
+			}
+			h := closeHandler{closed: make(chan error, 1)}
+			c.Handle(h)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			if test.eio == "3" {
+				deadline := time.Now().Add(time.Second * 5)
+				for c.RTT() == 0 && time.Now().Before(deadline) {
+					time.Sleep(time.Millisecond * 10)
+				}
+				if c.RTT() == 0 {
+					t.Error("RTT should be measured")
+				}
+				atomic.StoreInt32(&mute, 1)
+			}
+			select {
+			case err := <-h.closed:
+				if err != ErrorPingTimeout {
+					t.Error("close error mismatch", err)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("connection is not closed")
+			}
+			if c.Connected() {
+				t.Error("client should be disconnected")
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package eventio
+
+import (
+	"errors"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons of LifecycleDisconnected, as in the JavaScript client.
+const (
+	ReasonClientClose    = "io client disconnect"
+	ReasonPingTimeout    = "ping timeout"
+	ReasonTransportClose = "transport close"
+	ReasonTransportError = "transport error"
+)
+
+// LifecycleEventType is the type of a LifecycleEvent.
+type LifecycleEventType int
+
+const (
+	// LifecycleConnected is emitted when the connection is opened.
+	LifecycleConnected LifecycleEventType = iota
+	// LifecycleDisconnected is emitted when the connection is closed.
+	LifecycleDisconnected
+	// LifecycleError is emitted on errors which do not close the connection by themselves.
+	LifecycleError
+	// LifecycleReconnecting is emitted before each attempt to reconnect, by transports which reconnect
+	// such as the Server SDK 5 transport of gamelift when the service refreshes the connection.
+	LifecycleReconnecting
+)
+
+func (t LifecycleEventType) String() string {
+	switch t {
+	case LifecycleConnected:
+		return "Connected"
+	case LifecycleDisconnected:
+		return "Disconnected"
+	case LifecycleError:
+		return "Error"
+	case LifecycleReconnecting:
+		return "Reconnecting"
+	default:
+		return "Unknown"
+	}
+}
+
+// LifecycleEvent is an event of the lifecycle of a connection.
+type LifecycleEvent struct {
+	Type LifecycleEventType
+	// SID is the session ID of LifecycleConnected.
+	SID string
+	// Reason is the reason of LifecycleDisconnected.
+	Reason string
+	// Err is the error of LifecycleError, and that closed the connection of LifecycleDisconnected if any.
+	Err error
+	// Attempt is the number of the attempt of LifecycleReconnecting, starting from 1.
+	Attempt int
+}
+
+// OnLifecycle sets fn to receive the lifecycle events of the connection. It should be called before Open.
+// fn is called on the goroutines of the client and should not block.
+//
+// The client does not reconnect by itself, so it does not emit LifecycleReconnecting. After
+// LifecycleDisconnected, a new client has to be opened.
+func (c *Client) OnLifecycle(fn func(e LifecycleEvent)) {
+	c.lifecycle = fn
+}
+
+func (c *Client) emit(e LifecycleEvent) {
+	if c.lifecycle != nil {
+		c.lifecycle(e)
+	}
+}
+
+// DisconnectReason returns the reason of LifecycleDisconnected for the error closing a connection.
+func DisconnectReason(err error) string {
+	switch {
+	case err == nil:
+		return ReasonClientClose
+	case errors.Is(err, ErrorPingTimeout):
+		return ReasonPingTimeout
+	case errors.Is(err, ErrorTransportClose),
+		websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived):
+		return ReasonTransportClose
+	default:
+		return ReasonTransportError
+	}
+}
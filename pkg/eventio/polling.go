@@ -0,0 +1,305 @@
+package eventio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transports of Engine.IO.
+const (
+	TransportPolling   = "polling"
+	TransportWebsocket = "websocket"
+)
+
+// SetTransports sets the transports to try in order. It should be called before Open.
+// The default is only TransportWebsocket.
+//
+// If TransportPolling comes first, the client opens with HTTP long-polling and upgrades to
+// websocket when the server offers it and TransportWebsocket is also set. If TransportWebsocket
+// comes first, the client falls back to polling when the websocket cannot be opened.
+func (c *Client) SetTransports(transports ...string) {
+	c.transports = transports
+}
+
+// SetHTTPClient sets the HTTP client of the polling transport. It should be called before Open.
+func (c *Client) SetHTTPClient(hc *http.Client) {
+	c.httpClient = hc
+	c.customHTTPClient = true
+}
+
+// Transport returns the transport in use.
+func (c *Client) Transport() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.polling {
+		return TransportPolling
+	}
+	return TransportWebsocket
+}
+
+func (c *Client) allows(transport string) bool {
+	for _, t := range c.transports {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+// pollingURL returns the URL of the polling transport, whose scheme is http or https.
+func (c *Client) pollingURL() (string, error) {
+	u, err := c.transportURL(TransportPolling)
+	if err != nil {
+		return "", err
+	}
+	u = strings.Replace(u, "ws://", "http://", 1)
+	return strings.Replace(u, "wss://", "https://", 1), nil
+}
+
+// pollRequest sends a request of the polling transport and returns the body of the response.
+func (c *Client) pollRequest(ctx context.Context, method string, body []byte) (string, error) {
+	u, err := c.pollingURL()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range c.dialOptions.Header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := c.dialOptions.readAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		var e struct {
+			Code int `json:"code"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Code == 5 {
+			return "", ErrorUnsupportedProtocol
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %v", ErrorHttpStatusNotOk, resp.Status)
+	}
+	return string(data), nil
+}
+
+// get receives the packets of a polling cycle.
+func (c *Client) get(ctx context.Context) ([]Packet, error) {
+	data, err := c.pollRequest(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	var packets []Packet
+	if c.protocol == Protocol4 {
+		packets, err = ParsePayloadsV4(data)
+	} else {
+		packets, err = ParsePayloads(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.frameHook != nil {
+		for _, p := range packets {
+			c.frameHook(Inbound, hookFrame(p))
+		}
+	}
+	return packets, nil
+}
+
+// post sends packets in a payload of the polling transport.
+func (c *Client) post(packets []Packet) error {
+	var (
+		data []byte
+		err  error
+	)
+	if c.protocol == Protocol4 {
+		data, err = EncodePayloadsV4(packets)
+	} else {
+		data, err = EncodePayloads(packets)
+	}
+	if err != nil {
+		return err
+	}
+	if c.frameHook != nil {
+		for _, p := range packets {
+			c.frameHook(Outbound, hookFrame(p))
+		}
+	}
+	ctx, cancel := c.writeContext()
+	defer cancel()
+	_, err = c.pollRequest(ctx, http.MethodPost, data)
+	return err
+}
+
+// hookFrame returns the frame of p passed to FrameHook.
+func hookFrame(p Packet) string {
+	if p.Binary {
+		s, _ := EncodeBase64Packet(p)
+		return s
+	}
+	data, _ := EncodePacket(p)
+	return string(data)
+}
+
+// openPolling performs the handshake of the polling transport.
+func (c *Client) openPolling() error {
+	ctx, cancel := context.WithTimeout(c.ctx, c.dialOptions.handshakeTimeout())
+	defer cancel()
+	packets, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+	if len(packets) == 0 || packets[0].Type != Open {
+		return fmt.Errorf("%w: no open packet", ErrorHandshake)
+	}
+	c.mu.Lock()
+	c.polling = true
+	c.mu.Unlock()
+	c.setConnected(true)
+	for _, p := range packets {
+		if err := c.HandlePacket(p); err != nil {
+			return err
+		}
+	}
+	c.pollStop = make(chan struct{})
+	c.pollStopped = make(chan struct{})
+	c.emit(LifecycleEvent{Type: LifecycleConnected, SID: c.sid})
+	go c.readPolling()
+	return nil
+}
+
+// readPolling polls until the client is closed or the transport is upgraded.
+func (c *Client) readPolling() {
+	defer close(c.pollStopped)
+	for {
+		select {
+		case <-c.pollStop:
+			return
+		case <-c.done:
+			return
+		default:
+		}
+		packets, err := c.get(c.ctx)
+		if err != nil {
+			c.logger.Log("error occurred in eventio.Client.readPolling()", err)
+			c.shutdown(err)
+			return
+		}
+		for _, p := range packets {
+			if err := c.HandlePacket(p); err != nil {
+				c.shutdown(err)
+				return
+			}
+		}
+	}
+}
+
+// writePolling sends p and the packets queued after it in a payload, up to MaxPayload bytes if known.
+func (c *Client) writePolling(p Packet) error {
+	packets := []Packet{p}
+	size := len(p.Data)
+	for c.maxPayload <= 0 || size < c.maxPayload {
+		select {
+		case q := <-c.sendCh:
+			packets = append(packets, q)
+			size += len(q.Data)
+			continue
+		default:
+		}
+		break
+	}
+	return c.post(packets)
+}
+
+// probe opens a websocket to upgrade the polling transport to, and checks it with the probe ping.
+// The websocket is passed to loop, which completes the upgrade.
+func (c *Client) probe() {
+	u, err := c.transportURL(TransportWebsocket)
+	if err != nil {
+		c.logger.Log("failed to upgrade to websocket, keep polling", err)
+		c.emit(LifecycleEvent{Type: LifecycleError, Err: err})
+		return
+	}
+	ws, _, err := c.dialWebsocket(u)
+	if err != nil {
+		c.logger.Log("failed to upgrade to websocket, keep polling", err)
+		c.emit(LifecycleEvent{Type: LifecycleError, Err: err})
+		return
+	}
+	ping, _ := EncodePacket(Packet{Type: Ping, Data: "probe"})
+	if c.frameHook != nil {
+		c.frameHook(Outbound, string(ping))
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, ping); err != nil {
+		c.logger.Log("failed to upgrade to websocket, keep polling", err)
+		ws.Close()
+		return
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Millisecond * time.Duration(c.pingTimeout)))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		c.logger.Log("failed to upgrade to websocket, keep polling", err)
+		ws.Close()
+		return
+	}
+	if c.frameHook != nil {
+		c.frameHook(Inbound, string(data))
+	}
+	if p, err := ParsePacket(string(data)); err != nil || p.Type != Pong || p.Data != "probe" {
+		c.logger.Log("unexpected probe response, keep polling", string(data))
+		ws.Close()
+		return
+	}
+	ws.SetReadDeadline(time.Time{})
+	select {
+	case c.upgradeCh <- ws:
+	case <-c.done:
+		ws.Close()
+	}
+}
+
+// upgrade switches the transport to ws after the polling cycle in flight completes.
+// It is called by loop, so that no packet is posted meanwhile.
+func (c *Client) upgrade(ws *websocket.Conn) error {
+	close(c.pollStop)
+	select {
+	case <-c.pollStopped:
+	case <-c.done:
+		ws.Close()
+		return nil
+	}
+	data, _ := EncodePacket(Packet{Type: Upgrade})
+	if c.frameHook != nil {
+		c.frameHook(Outbound, string(data))
+	}
+	if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+		ws.Close()
+		return err
+	}
+	c.mu.Lock()
+	c.c = ws
+	c.polling = false
+	c.mu.Unlock()
+	c.logger.Log("upgraded to websocket")
+	go c.readWebsocket()
+	return nil
+}
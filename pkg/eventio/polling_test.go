@@ -0,0 +1,175 @@
+package eventio
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pollingServer is an Engine.IO v3 server of polling and websocket transports for tests.
+type pollingServer struct {
+	websocket bool
+	// out is the packets to send, and recv is the packets received.
+	out  chan Packet
+	recv chan string
+}
+
+func newPollingServer(websocket bool) *pollingServer {
+	return &pollingServer{websocket: websocket, out: make(chan Packet, 10), recv: make(chan string, 10)}
+}
+
+func (s *pollingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("transport") == TransportWebsocket:
+		if !s.websocket || q.Get("sid") != "sid" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.serveWebsocket(w, r)
+	case q.Get("sid") == "":
+		upgrades := `[]`
+		if s.websocket {
+			upgrades = `["websocket"]`
+		}
+		data, _ := EncodePayloads([]Packet{{Type: Open, Data: `{"sid":"sid","upgrades":` + upgrades + `,"pingInterval":25000,"pingTimeout":5000}`}})
+		w.Write(data)
+	case r.Method == http.MethodGet:
+		var packets []Packet
+		select {
+		case p := <-s.out:
+			packets = append(packets, p)
+		case <-time.After(time.Millisecond * 200):
+			packets = append(packets, Packet{Type: Noop})
+		}
+		data, _ := EncodePayloads(packets)
+		w.Write(data)
+	case r.Method == http.MethodPost:
+		body, _ := ioutil.ReadAll(r.Body)
+		packets, err := ParsePayloads(string(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, p := range packets {
+			s.recv <- hookFrame(p)
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+func (s *pollingServer) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "2probe" {
+		return
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte("3probe"))
+	// let the polling cycle in flight return
+	s.out <- Packet{Type: Noop}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "5" {
+		return
+	}
+	go func() {
+		for p := range s.out {
+			data, _ := EncodePacket(p)
+			if conn.WriteMessage(websocket.TextMessage, data) != nil {
+				return
+			}
+		}
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.recv <- "ws " + string(data)
+	}
+}
+
+func TestPolling(t *testing.T) {
+	tests := []struct {
+		name       string
+		websocket  bool
+		transports []string
+		expect     string
+	}{
+		{"polling only", true, []string{TransportPolling}, TransportPolling},
+		{"upgrade", true, []string{TransportPolling, TransportWebsocket}, TransportWebsocket},
+		{"fallback", false, []string{TransportWebsocket, TransportPolling}, TransportPolling},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newPollingServer(test.websocket)
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+			c.SetTransports(test.transports...)
+			h := make(chanHandler, 10)
+			c.Handle(h)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			deadline := time.Now().Add(time.Second * 5)
+			for c.Transport() != test.expect && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			if c.Transport() != test.expect {
+				t.Fatal("transport mismatch", c.Transport())
+			}
+
+			s.out <- Packet{Type: Message, Data: "from server"}
+			select {
+			case msg := <-h:
+				if msg != "from server" {
+					t.Error("message mismatch", msg)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("no message from the server")
+			}
+
+			c.Send("hello")
+			c.SendBinary([]byte{1, 2, 3})
+			expect := []string{"4hello", "b4AQID"}
+			if test.expect == TransportWebsocket {
+				expect = []string{"ws 4hello", "ws \x04\x01\x02\x03"}
+			}
+			for _, e := range expect {
+				select {
+				case s := <-s.recv:
+					if s != e {
+						t.Errorf("packet mismatch: %q, expected %q", s, e)
+					}
+				case <-time.After(time.Second * 5):
+					t.Fatal("no packet from the client")
+				}
+			}
+		})
+	}
+}
+
+func TestPollingHandshake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("1:6"))
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	c.SetTransports(TransportPolling)
+	if err := c.Open(); !errors.Is(err, ErrorHandshake) {
+		t.Error("error mismatch", err)
+	}
+}
@@ -0,0 +1,241 @@
+package eventio
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrorQueueFull = errors.New("send queue is full")
+	ErrorClosed    = errors.New("client is closed")
+)
+
+// QueuePolicy decides what Send does when the send queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks Send until the queue has room or the client is closed.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest discards the oldest queued packet to make room.
+	QueueDropOldest
+	// QueueError fails Send with ErrorQueueFull.
+	QueueError
+)
+
+const (
+	DefaultQueueSize    = 100
+	DefaultFlushTimeout = time.Second * 5
+)
+
+// QueueOptions configures the queue of packets to send.
+type QueueOptions struct {
+	// Size is the capacity of the queue. Zero means DefaultQueueSize.
+	Size   int
+	Policy QueuePolicy
+	// WriteTimeout limits the time to write a packet to the transport. Zero means no limit.
+	WriteTimeout time.Duration
+	// FlushTimeout limits the time Close waits for the queued packets to be written.
+	// Zero means DefaultFlushTimeout, and a negative value discards them.
+	FlushTimeout time.Duration
+}
+
+// QueueStats is a snapshot of the send queue.
+type QueueStats struct {
+	// Depth is the number of packets waiting to be written, and Capacity is the size of the queue.
+	Depth    int
+	Capacity int
+	// HighWater is the maximum depth observed.
+	HighWater int
+	// Dropped is the number of packets discarded by QueueDropOldest, and Rejected is the number of
+	// packets refused by QueueError.
+	Dropped  int
+	Rejected int
+}
+
+// SetQueueOptions configures the send queue. It should be called before Open.
+//
+// With QueueDropOldest or QueueError, a message split into several packets, such as a socket.io
+// packet with binary attachments, may be sent partially when the queue is full.
+func (c *Client) SetQueueOptions(o QueueOptions) {
+	if o.Size <= 0 {
+		o.Size = DefaultQueueSize
+	}
+	if o.FlushTimeout == 0 {
+		o.FlushTimeout = DefaultFlushTimeout
+	}
+	c.queueOptions = o
+	c.sendCh = make(chan Packet, o.Size)
+}
+
+// QueueStats returns the statistics of the send queue.
+func (c *Client) QueueStats() QueueStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.queueStats
+	s.Depth = len(c.sendCh)
+	s.Capacity = cap(c.sendCh)
+	return s
+}
+
+// enqueue queues p to send by the policy of the queue.
+func (c *Client) enqueue(p Packet) error {
+	select {
+	case <-c.done:
+		return ErrorClosed
+	default:
+	}
+	switch c.queueOptions.Policy {
+	case QueueDropOldest:
+		for {
+			select {
+			case c.sendCh <- p:
+				c.queued()
+				return nil
+			default:
+			}
+			select {
+			case <-c.sendCh:
+				c.mu.Lock()
+				c.queueStats.Dropped++
+				c.mu.Unlock()
+			default:
+			}
+		}
+	case QueueError:
+		select {
+		case c.sendCh <- p:
+			c.queued()
+			return nil
+		default:
+			c.mu.Lock()
+			c.queueStats.Rejected++
+			c.mu.Unlock()
+			return ErrorQueueFull
+		}
+	default:
+		select {
+		case c.sendCh <- p:
+			c.queued()
+			return nil
+		case <-c.done:
+			return ErrorClosed
+		}
+	}
+}
+
+func (c *Client) queued() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := len(c.sendCh); n > c.queueStats.HighWater {
+		c.queueStats.HighWater = n
+	}
+}
+
+// sendControl queues a packet of the protocol, such as a ping, ahead of the messages.
+// It never blocks, as it is called by loop and the read goroutine; the packet is dropped if the
+// control queue is full, which the heartbeat eventually detects.
+func (c *Client) sendControl(p Packet) {
+	select {
+	case c.controlCh <- p:
+	default:
+		c.logger.Log("control queue is full, dropping", p.Type)
+	}
+}
+
+// write writes p, and the packets queued after it when polling, to the transport.
+func (c *Client) write(p Packet) error {
+	c.logger.Log("sending", p.Type)
+	if c.Transport() == TransportPolling {
+		return c.writePolling(p)
+	}
+	typ := websocket.TextMessage
+	var (
+		data []byte
+		err  error
+	)
+	if p.Binary && c.protocol == Protocol4 {
+		typ = websocket.BinaryMessage
+		data = []byte(p.Data)
+	} else if p.Binary {
+		typ = websocket.BinaryMessage
+		data, err = EncodeBinaryFrame(p)
+	} else {
+		data, err = EncodePacket(p)
+	}
+	if err != nil {
+		return err
+	}
+	if c.frameHook != nil {
+		if p.Binary {
+			s, _ := EncodeBase64Packet(p)
+			c.frameHook(Outbound, s)
+		} else {
+			c.frameHook(Outbound, string(data))
+		}
+	}
+	if d := c.queueOptions.WriteTimeout; d > 0 {
+		c.c.SetWriteDeadline(time.Now().Add(d))
+	}
+	return c.c.WriteMessage(typ, data)
+}
+
+// writeContext returns the context of a polling request writing packets.
+func (c *Client) writeContext() (context.Context, context.CancelFunc) {
+	if d := c.queueOptions.WriteTimeout; d > 0 {
+		return context.WithTimeout(c.ctx, d)
+	}
+	return context.WithCancel(c.ctx)
+}
+
+// flush writes the queued packets. It is called by loop on the request of Close.
+func (c *Client) flush() error {
+	for {
+		select {
+		case p := <-c.controlCh:
+			if err := c.write(p); err != nil {
+				return err
+			}
+		case p := <-c.sendCh:
+			if err := c.write(p); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// requestFlush asks loop to flush the queued packets and send the close packet, and waits for it
+// up to the flush timeout.
+func (c *Client) requestFlush() {
+	c.mu.Lock()
+	looping := c.looping
+	c.mu.Unlock()
+	timeout := c.queueOptions.FlushTimeout
+	if !looping || timeout < 0 || !c.Connected() {
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	reply := make(chan error, 1)
+	select {
+	case c.flushCh <- reply:
+	case <-c.done:
+		return
+	case <-timer.C:
+		c.logger.Log("timed out flushing the send queue")
+		return
+	}
+	select {
+	case err := <-reply:
+		if err != nil {
+			c.logger.Log("failed to flush the send queue", err)
+		}
+	case <-c.done:
+	case <-timer.C:
+		c.logger.Log("timed out flushing the send queue")
+	}
+}
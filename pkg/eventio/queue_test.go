@@ -0,0 +1,107 @@
+package eventio
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestQueuePolicy(t *testing.T) {
+	c := NewClient("ws://localhost/engine.io/", nopLogger{})
+	c.SetQueueOptions(QueueOptions{Size: 2, Policy: QueueDropOldest})
+	for i := 0; i < 3; i++ {
+		if err := c.Send(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := c.QueueStats(); s != (QueueStats{Depth: 2, Capacity: 2, HighWater: 2, Dropped: 1}) {
+		t.Error("stats mismatch", s)
+	}
+	if p := <-c.sendCh; p.Data != "1" {
+		t.Error("oldest packet should be dropped", p)
+	}
+
+	c = NewClient("ws://localhost/engine.io/", nopLogger{})
+	c.SetQueueOptions(QueueOptions{Size: 2, Policy: QueueError})
+	c.Send("0")
+	c.Send("1")
+	if err := c.Send("2"); !errors.Is(err, ErrorQueueFull) {
+		t.Error("error mismatch", err)
+	}
+	if s := c.QueueStats(); s != (QueueStats{Depth: 2, Capacity: 2, HighWater: 2, Rejected: 1}) {
+		t.Error("stats mismatch", s)
+	}
+
+	c = NewClient("ws://localhost/engine.io/", nopLogger{})
+	c.SetQueueOptions(QueueOptions{Size: 1})
+	c.Send("0")
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.Send("1")
+	}()
+	select {
+	case err := <-sent:
+		t.Fatal("Send should block", err)
+	case <-time.After(time.Millisecond * 50):
+	}
+	c.Close()
+	if err := <-sent; !errors.Is(err, ErrorClosed) {
+		t.Error("error mismatch", err)
+	}
+}
+
+func TestFlushOnClose(t *testing.T) {
+	const n = 50
+	recv := make(chan string, n)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":5000}`))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// slow down to keep the packets queued until Close
+			time.Sleep(time.Millisecond)
+			recv <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	c.SetProtocol(Protocol3)
+	c.SetQueueOptions(QueueOptions{WriteTimeout: time.Second})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := c.Send(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+	if err := c.Send("after close"); !errors.Is(err, ErrorClosed) {
+		t.Error("error mismatch", err)
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-recv:
+			if msg != fmt.Sprint("4", i) {
+				t.Fatal("message mismatch", msg)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("queued message is not flushed", i)
+		}
+	}
+}
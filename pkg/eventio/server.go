@@ -0,0 +1,697 @@
+package eventio
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+
+	"github.com/neguse/gomelift/pkg/log"
+)
+
+const (
+	DefaultPingInterval = 25 * time.Second
+	DefaultPingTimeout  = 20 * time.Second
+	DefaultMaxPayload   = 1000000
+)
+
+// ErrorTransportClose is passed to CloseHandler when the client closes the session.
+var ErrorTransportClose = errors.New("transport closed")
+
+// Error codes of the responses to requests the server does not accept.
+const (
+	CodeTransportUnknown    = 0
+	CodeUnknownSid          = 1
+	CodeBadHandshakeMethod  = 2
+	CodeBadRequest          = 3
+	CodeForbidden           = 4
+	CodeUnsupportedProtocol = 5
+)
+
+var codeMessages = map[int]string{
+	CodeTransportUnknown:    "Transport unknown",
+	CodeUnknownSid:          "Session ID unknown",
+	CodeBadHandshakeMethod:  "Bad handshake method",
+	CodeBadRequest:          "Bad request",
+	CodeForbidden:           "Forbidden",
+	CodeUnsupportedProtocol: "Unsupported protocol version",
+}
+
+// Server is an Engine.IO server of the polling and websocket transports, compatible with Client and
+// the node engine.io clients.
+type Server struct {
+	// PingInterval and PingTimeout are announced to clients in the open packet. A session without
+	// a packet for PingInterval+PingTimeout is closed. In Protocol4, the server sends pings every PingInterval.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// MaxPayload limits the size of a polling request in bytes, and is announced to clients in Protocol4.
+	MaxPayload int
+	// Transports are the transports accepted. Empty means both.
+	Transports []string
+	// Protocols are the protocol versions accepted. Empty means both Protocol3 and Protocol4.
+	Protocols []Protocol
+	// Upgrader upgrades requests to websocket connections.
+	Upgrader websocket.Upgrader
+
+	logger    log.Logger
+	mu        sync.Mutex
+	onConnect func(s *Session)
+	sessions  map[string]*Session
+	closed    bool
+}
+
+func NewServer(logger log.Logger) *Server {
+	return &Server{
+		PingInterval: DefaultPingInterval,
+		PingTimeout:  DefaultPingTimeout,
+		MaxPayload:   DefaultMaxPayload,
+		logger:       logger,
+		sessions:     make(map[string]*Session),
+	}
+}
+
+// OnConnect sets fn to be called with new sessions. It should be called before serving.
+// fn is called before the packets of the session are read, so it can set the handler with Session.Handle.
+func (s *Server) OnConnect(fn func(sess *Session)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onConnect = fn
+}
+
+// Sessions returns the open sessions in the order of ID.
+func (s *Server) Sessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []*Session
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].sid < sessions[j].sid })
+	return sessions
+}
+
+// Close closes all sessions. Requests served later are refused.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	for _, sess := range s.Sessions() {
+		sess.Close()
+	}
+	return nil
+}
+
+func (s *Server) session(sid string) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[sid]
+}
+
+func (s *Server) accepts(transport string) bool {
+	if transport != TransportPolling && transport != TransportWebsocket {
+		return false
+	}
+	if len(s.Transports) == 0 {
+		return true
+	}
+	for _, t := range s.Transports {
+		if t == transport {
+			return true
+		}
+	}
+	return false
+}
+
+// protocolOf returns the protocol version requested by the EIO parameter, Protocol3 if missing.
+func (s *Server) protocolOf(r *http.Request) (Protocol, bool) {
+	var p Protocol
+	switch r.URL.Query().Get("EIO") {
+	case "", "3":
+		p = Protocol3
+	case "4":
+		p = Protocol4
+	default:
+		return 0, false
+	}
+	if len(s.Protocols) == 0 {
+		return p, true
+	}
+	for _, q := range s.Protocols {
+		if q == p {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// writeError responds to a request the server does not accept with the code, as engine.io does.
+func writeError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}{code, codeMessages[code]})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	transport := q.Get("transport")
+	if !s.accepts(transport) {
+		writeError(w, CodeTransportUnknown)
+		return
+	}
+	protocol, ok := s.protocolOf(r)
+	if !ok {
+		writeError(w, CodeUnsupportedProtocol)
+		return
+	}
+	sid := q.Get("sid")
+	if sid == "" {
+		if transport == TransportPolling && r.Method != http.MethodGet {
+			writeError(w, CodeBadHandshakeMethod)
+			return
+		}
+		s.handshake(w, r, transport, protocol)
+		return
+	}
+	sess := s.session(sid)
+	if sess == nil {
+		writeError(w, CodeUnknownSid)
+		return
+	}
+	if sess.protocol != protocol {
+		writeError(w, CodeBadRequest)
+		return
+	}
+	if transport == TransportWebsocket {
+		sess.serveUpgrade(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		sess.servePollGet(w, r)
+	case http.MethodPost:
+		sess.servePollPost(w, r)
+	default:
+		writeError(w, CodeBadRequest)
+	}
+}
+
+// handshake opens a new session.
+func (s *Server) handshake(w http.ResponseWriter, r *http.Request, transport string, protocol Protocol) {
+	var ws *websocket.Conn
+	if transport == TransportWebsocket {
+		var err error
+		if ws, err = s.Upgrader.Upgrade(w, r, nil); err != nil {
+			s.logger.Log("failed to upgrade", err)
+			return
+		}
+	}
+	sess := &Session{
+		server:    s,
+		sid:       xid.New().String(),
+		req:       r,
+		protocol:  protocol,
+		handler:   nullHandler{},
+		transport: transport,
+		ws:        ws,
+		signal:    make(chan struct{}, 1),
+		heartbeat: make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	open := OpenResponse{
+		Sid:          sess.sid,
+		Upgrades:     []string{},
+		PingInterval: int(s.PingInterval / time.Millisecond),
+		PingTimeout:  int(s.PingTimeout / time.Millisecond),
+	}
+	if transport == TransportPolling && s.accepts(TransportWebsocket) {
+		open.Upgrades = []string{TransportWebsocket}
+	}
+	if protocol == Protocol4 {
+		open.MaxPayload = s.MaxPayload
+	}
+	data, err := json.Marshal(open)
+	if err != nil {
+		s.logger.Panic("failed to marshal OpenResponse", err)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		if ws != nil {
+			ws.Close()
+		} else {
+			writeError(w, CodeForbidden)
+		}
+		return
+	}
+	s.sessions[sess.sid] = sess
+	fn := s.onConnect
+	s.mu.Unlock()
+
+	openPacket := Packet{Type: Open, Data: string(data)}
+	if ws != nil {
+		if err := sess.writeWebsocket(ws, openPacket); err != nil {
+			sess.close(err, false)
+			return
+		}
+	}
+	go sess.watch()
+	if fn != nil {
+		fn(sess)
+	}
+	if ws != nil {
+		sess.readWebsocket(ws)
+		return
+	}
+	sess.writePayload(w, []Packet{openPacket})
+}
+
+// Session is a connection of a client to a Server.
+type Session struct {
+	server   *Server
+	sid      string
+	req      *http.Request
+	protocol Protocol
+	handler  Handler
+
+	// writeMu serializes the writes to the websocket, and the switch of the transport to it.
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	// transport is the transport in use, and ws is the websocket if it is TransportWebsocket.
+	transport string
+	ws        *websocket.Conn
+	// queue is the packets waiting for a polling request, which is notified by signal.
+	queue   []Packet
+	polling bool
+	signal  chan struct{}
+	// heartbeat notifies watch of packets from the client.
+	heartbeat chan struct{}
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	return s.sid
+}
+
+// Request returns the handshake request of the session.
+func (s *Session) Request() *http.Request {
+	return s.req
+}
+
+// Protocol returns the protocol version of the session.
+func (s *Session) Protocol() Protocol {
+	return s.protocol
+}
+
+// Transport returns the transport in use.
+func (s *Session) Transport() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.transport
+}
+
+// Handle sets the handler of the messages from the client. It should be called in the OnConnect handler.
+// The handler may implement BinaryHandler and CloseHandler; HandleClose is called with nil when the server
+// closes the session, ErrorTransportClose when the client does, and ErrorPingTimeout when the client is lost.
+func (s *Session) Handle(h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = h
+}
+
+func (s *Session) getHandler() Handler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.handler
+}
+
+// Send sends a message to the client.
+func (s *Session) Send(msg string) error {
+	return s.send(Packet{Type: Message, Data: msg})
+}
+
+// SendBinary sends a binary message to the client.
+func (s *Session) SendBinary(data []byte) error {
+	return s.send(Packet{Type: Message, Data: string(data), Binary: true})
+}
+
+// Close closes the session after sending the close packet.
+func (s *Session) Close() error {
+	s.close(nil, true)
+	return nil
+}
+
+// send writes p to the websocket, or queues it for the next polling request.
+func (s *Session) send(p Packet) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrorClosed
+	}
+	ws := s.ws
+	if s.transport == TransportPolling {
+		s.queue = append(s.queue, p)
+		s.mu.Unlock()
+		s.notify()
+		return nil
+	}
+	s.mu.Unlock()
+	if err := s.writeWebsocket(ws, p); err != nil {
+		go s.close(err, false)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) notify() {
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+// close closes the session with err, sending the close packet to the client if graceful.
+func (s *Session) close(err error, graceful bool) {
+	s.closeOnce.Do(func() {
+		if graceful {
+			s.send(Packet{Type: Close})
+		}
+		s.mu.Lock()
+		s.closed = true
+		ws := s.ws
+		s.mu.Unlock()
+		close(s.done)
+		if ws != nil {
+			ws.Close()
+		}
+		srv := s.server
+		srv.mu.Lock()
+		delete(srv.sessions, s.sid)
+		srv.mu.Unlock()
+		if ch, ok := s.getHandler().(CloseHandler); ok {
+			ch.HandleClose(err)
+		}
+	})
+}
+
+// watch closes the session when the client sends no packet for PingInterval+PingTimeout,
+// and sends pings in Protocol4.
+func (s *Session) watch() {
+	srv := s.server
+	timeout := srv.PingInterval + srv.PingTimeout
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var pingCh <-chan time.Time
+	if s.protocol == Protocol4 {
+		ticker := time.NewTicker(srv.PingInterval)
+		defer ticker.Stop()
+		pingCh = ticker.C
+	}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-pingCh:
+			s.send(Packet{Type: Ping})
+		case <-s.heartbeat:
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(timeout)
+		case <-timer.C:
+			srv.logger.Log("no heartbeat from the client, closing", s.sid)
+			s.close(ErrorPingTimeout, false)
+			return
+		}
+	}
+}
+
+// handlePacket handles a packet from the client.
+func (s *Session) handlePacket(p Packet) {
+	select {
+	case s.heartbeat <- struct{}{}:
+	default:
+	}
+	switch p.Type {
+	case Ping:
+		if s.protocol == Protocol3 {
+			s.send(Packet{Type: Pong, Data: p.Data})
+		}
+	case Close:
+		s.close(ErrorTransportClose, false)
+	case Message:
+		h := s.getHandler()
+		if !p.Binary {
+			h.HandleMessage(p.Data)
+		} else if bh, ok := h.(BinaryHandler); ok {
+			bh.HandleBinaryMessage([]byte(p.Data))
+		} else {
+			s.server.logger.Log("binary message is not handled")
+		}
+	}
+}
+
+func (s *Session) writeWebsocket(ws *websocket.Conn, p Packet) error {
+	typ := websocket.TextMessage
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case p.Binary && s.protocol == Protocol4:
+		typ = websocket.BinaryMessage
+		data = []byte(p.Data)
+	case p.Binary:
+		typ = websocket.BinaryMessage
+		data, err = EncodeBinaryFrame(p)
+	default:
+		data, err = EncodePacket(p)
+	}
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(typ, data)
+}
+
+// readWebsocket reads packets from ws until the session is closed.
+func (s *Session) readWebsocket(ws *websocket.Conn) {
+	for {
+		typ, data, err := ws.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				err = ErrorTransportClose
+			}
+			s.close(err, false)
+			return
+		}
+		var p Packet
+		switch {
+		case typ == websocket.BinaryMessage && s.protocol == Protocol4:
+			p = Packet{Type: Message, Data: string(data), Binary: true}
+		case typ == websocket.BinaryMessage:
+			p, err = ParseBinaryFrame(data)
+		default:
+			p, err = ParsePacket(string(data))
+		}
+		if err != nil {
+			s.server.logger.Log("failed to parse packet", err)
+			continue
+		}
+		s.handlePacket(p)
+	}
+}
+
+func (s *Session) writePayload(w http.ResponseWriter, packets []Packet) {
+	var (
+		data []byte
+		err  error
+	)
+	if s.protocol == Protocol4 {
+		data, err = EncodePayloadsV4(packets)
+	} else {
+		data, err = EncodePayloads(packets)
+	}
+	if err != nil {
+		s.server.logger.Log("failed to encode payload", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Write(data)
+}
+
+// servePollGet responds with the queued packets, waiting for one if none.
+func (s *Session) servePollGet(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.transport != TransportPolling {
+		s.mu.Unlock()
+		writeError(w, CodeBadRequest)
+		return
+	}
+	if s.polling {
+		s.mu.Unlock()
+		writeError(w, CodeBadRequest)
+		// engine.io closes the session on an overlapping polling request
+		s.close(errors.New("overlapping polling request"), false)
+		return
+	}
+	s.polling = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.polling = false
+		s.mu.Unlock()
+	}()
+	for {
+		s.mu.Lock()
+		packets := s.queue
+		s.queue = nil
+		closed := s.closed
+		upgraded := s.transport != TransportPolling
+		s.mu.Unlock()
+		switch {
+		case len(packets) > 0:
+			s.writePayload(w, packets)
+			return
+		case closed:
+			s.writePayload(w, []Packet{{Type: Close}})
+			return
+		case upgraded:
+			s.writePayload(w, []Packet{{Type: Noop}})
+			return
+		}
+		select {
+		case <-s.signal:
+		case <-s.done:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// servePollPost handles the packets of a polling request.
+func (s *Session) servePollPost(w http.ResponseWriter, r *http.Request) {
+	var reader io.Reader = r.Body
+	if s.server.MaxPayload > 0 {
+		reader = http.MaxBytesReader(w, r.Body, int64(s.server.MaxPayload))
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		writeError(w, CodeBadRequest)
+		s.close(err, false)
+		return
+	}
+	var packets []Packet
+	if s.protocol == Protocol4 {
+		packets, err = ParsePayloadsV4(string(body))
+	} else {
+		packets, err = ParsePayloads(string(body))
+	}
+	if err != nil {
+		writeError(w, CodeBadRequest)
+		s.close(err, false)
+		return
+	}
+	for _, p := range packets {
+		s.handlePacket(p)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("ok"))
+}
+
+// releasePolling responds noop to the polling requests pending every 100ms until done is closed.
+func (s *Session) releasePolling(done chan struct{}) {
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		if s.polling && len(s.queue) == 0 {
+			s.queue = append(s.queue, Packet{Type: Noop})
+		}
+		s.mu.Unlock()
+		s.notify()
+		select {
+		case <-done:
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveUpgrade upgrades the polling session to the websocket of r after the probe.
+func (s *Session) serveUpgrade(w http.ResponseWriter, r *http.Request) {
+	if s.Transport() != TransportPolling {
+		writeError(w, CodeBadRequest)
+		return
+	}
+	ws, err := s.server.Upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.server.logger.Log("failed to upgrade", err)
+		return
+	}
+	ws.SetReadDeadline(time.Now().Add(s.server.PingTimeout))
+	_, data, err := ws.ReadMessage()
+	if p, perr := ParsePacket(string(data)); err != nil || perr != nil || p.Type != Ping || p.Data != "probe" {
+		ws.Close()
+		return
+	}
+	if err := s.writeWebsocket(ws, Packet{Type: Pong, Data: "probe"}); err != nil {
+		ws.Close()
+		return
+	}
+	// let the polling requests in flight return until the client completes the upgrade, as engine.io does
+	upgraded := make(chan struct{})
+	go s.releasePolling(upgraded)
+	_, data, err = ws.ReadMessage()
+	close(upgraded)
+	if p, perr := ParsePacket(string(data)); err != nil || perr != nil || p.Type != Upgrade {
+		ws.Close()
+		return
+	}
+	ws.SetReadDeadline(time.Time{})
+
+	s.writeMu.Lock()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.writeMu.Unlock()
+		ws.Close()
+		return
+	}
+	queue := s.queue
+	s.queue = nil
+	s.transport = TransportWebsocket
+	s.ws = ws
+	s.mu.Unlock()
+	for _, p := range queue {
+		if p.Type == Noop {
+			continue
+		}
+		if err := s.writeWebsocket(ws, p); err != nil {
+			s.writeMu.Unlock()
+			s.close(err, false)
+			return
+		}
+	}
+	s.writeMu.Unlock()
+	s.notify()
+	s.handlePacket(Packet{Type: Upgrade})
+	s.readWebsocket(ws)
+}
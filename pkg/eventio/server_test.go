@@ -0,0 +1,171 @@
+package eventio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoSession echoes the messages of a session.
+type echoSession struct {
+	sess   *Session
+	closed chan error
+}
+
+func (e echoSession) HandleMessage(msg string) {
+	e.sess.Send("echo " + msg)
+}
+
+func (e echoSession) HandleBinaryMessage(data []byte) {
+	e.sess.SendBinary(append([]byte{0}, data...))
+}
+
+func (e echoSession) HandleClose(err error) {
+	e.closed <- err
+}
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		protocol   Protocol
+		transports []string
+		expect     string
+	}{
+		{"websocket 3", Protocol3, []string{TransportWebsocket}, TransportWebsocket},
+		{"websocket 4", Protocol4, []string{TransportWebsocket}, TransportWebsocket},
+		{"polling 3", Protocol3, []string{TransportPolling}, TransportPolling},
+		{"polling 4", Protocol4, []string{TransportPolling}, TransportPolling},
+		{"upgrade 3", Protocol3, []string{TransportPolling, TransportWebsocket}, TransportWebsocket},
+		{"upgrade 4", Protocol4, []string{TransportPolling, TransportWebsocket}, TransportWebsocket},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(nopLogger{})
+			s.PingInterval = time.Millisecond * 100
+			s.PingTimeout = time.Millisecond * 500
+			closed := make(chan error, 1)
+			s.OnConnect(func(sess *Session) {
+				sess.Handle(echoSession{sess: sess, closed: closed})
+				sess.Send("welcome")
+			})
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+			c.SetProtocol(test.protocol)
+			c.SetTransports(test.transports...)
+			h := make(chanHandler, 10)
+			c.Handle(h)
+			if err := c.Open(); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			expect := func(msg string) {
+				t.Helper()
+				select {
+				case m := <-h:
+					if m != msg {
+						t.Errorf("message mismatch: %q, expected %q", m, msg)
+					}
+				case <-time.After(time.Second * 5):
+					t.Fatal("no message from the server, expected", msg)
+				}
+			}
+			expect("welcome")
+
+			deadline := time.Now().Add(time.Second * 5)
+			for c.Transport() != test.expect && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond * 10)
+			}
+			if c.Transport() != test.expect {
+				t.Fatal("transport mismatch", c.Transport())
+			}
+			if sessions := s.Sessions(); len(sessions) != 1 || sessions[0].Transport() != test.expect || sessions[0].Protocol() != test.protocol {
+				t.Fatal("session mismatch", sessions)
+			}
+
+			c.Send("hello")
+			expect("echo hello")
+			c.SendBinary([]byte{1, 2})
+			expect("binary [0 1 2]")
+
+			// heartbeats keep the session open
+			time.Sleep(time.Millisecond * 700)
+			c.Send("again")
+			expect("echo again")
+
+			c.Close()
+			select {
+			case err := <-closed:
+				if DisconnectReason(err) != ReasonTransportClose {
+					t.Error("close error mismatch", err)
+				}
+			case <-time.After(time.Second * 5):
+				t.Fatal("session is not closed")
+			}
+		})
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s := NewServer(nopLogger{})
+	closed := make(chan error, 1)
+	s.OnConnect(func(sess *Session) {
+		sess.Handle(echoSession{sess: sess, closed: closed})
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/engine.io/", nopLogger{})
+	h := closeHandler{closed: make(chan error, 1)}
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s.Close()
+	for _, ch := range []chan error{closed, h.closed} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second * 5):
+			t.Fatal("not closed")
+		}
+	}
+	if len(s.Sessions()) != 0 {
+		t.Error("sessions should be removed")
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	s := NewServer(nopLogger{})
+	s.Protocols = []Protocol{Protocol3}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"transport=flash", CodeTransportUnknown},
+		{"transport=polling&EIO=4", CodeUnsupportedProtocol},
+		{"transport=polling&EIO=3&sid=unknown", CodeUnknownSid},
+	}
+	for _, test := range tests {
+		resp, err := http.Get(server.URL + "/engine.io/?" + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var e struct {
+			Code int `json:"code"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || err != nil || e.Code != test.code {
+			t.Errorf("%s: response mismatch: %v %v %v", test.query, resp.Status, e.Code, err)
+		}
+	}
+}
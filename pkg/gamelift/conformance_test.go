@@ -0,0 +1,537 @@
+package gamelift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+type nopLogger struct{}
+
+func (l nopLogger) Log(msg string, args ...interface{}) {}
+
+func (l nopLogger) Panic(msg string, args ...interface{}) {
+	panic(fmt.Sprint(msg, args))
+}
+
+// fakeAuxProxy is the auxproxy side of the protocol, recording what the client sends.
+type fakeAuxProxy struct {
+	server       *httptest.Server
+	pingInterval int
+
+	query  chan url.Values
+	events chan socketio.Packet
+	acks   chan socketio.Packet
+	pings  chan time.Time
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func newFakeAuxProxy(pingInterval int) *fakeAuxProxy {
+	a := &fakeAuxProxy{
+		pingInterval: pingInterval,
+		query:        make(chan url.Values, 1),
+		events:       make(chan socketio.Packet, 100),
+		acks:         make(chan socketio.Packet, 100),
+		pings:        make(chan time.Time, 100),
+	}
+	a.server = httptest.NewServer(http.HandlerFunc(a.serve))
+	return a
+}
+
+func (a *fakeAuxProxy) URL() string {
+	return strings.Replace(a.server.URL, "http", "ws", 1) + "/socket.io/"
+}
+
+func (a *fakeAuxProxy) Close() {
+	a.server.Close()
+}
+
+func (a *fakeAuxProxy) serve(w http.ResponseWriter, r *http.Request) {
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	a.conn = conn
+	a.mu.Unlock()
+	a.query <- r.URL.Query()
+
+	open, _ := json.Marshal(eventio.OpenResponse{Sid: "sid", Upgrades: []string{}, PingInterval: a.pingInterval, PingTimeout: 60000})
+	a.write(eventio.Packet{Type: eventio.Open, Data: string(open)})
+	a.send(socketio.Packet{Type: socketio.Connect})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		ep, err := eventio.ParsePacket(string(data))
+		if err != nil {
+			panic(err)
+		}
+		switch ep.Type {
+		case eventio.Ping:
+			a.pings <- time.Now()
+			a.write(eventio.Packet{Type: eventio.Pong, Data: ep.Data})
+		case eventio.Message:
+			p, err := socketio.DecodePacket(ep.Data)
+			if err != nil {
+				panic(err)
+			}
+			switch p.Type {
+			case socketio.Event:
+				a.events <- p
+			case socketio.Ack:
+				a.acks <- p
+			}
+		}
+	}
+}
+
+func (a *fakeAuxProxy) write(p eventio.Packet) {
+	data, _ := eventio.EncodePacket(p)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		panic(err)
+	}
+}
+
+func (a *fakeAuxProxy) send(p socketio.Packet) {
+	s, err := socketio.EncodePacket(p)
+	if err != nil {
+		panic(err)
+	}
+	a.write(eventio.Packet{Type: eventio.Message, Data: s})
+}
+
+func (a *fakeAuxProxy) ack(p socketio.Packet, data ...interface{}) {
+	a.send(socketio.NewAckPacket(&p, data))
+}
+
+func (a *fakeAuxProxy) nextEvent(t *testing.T) socketio.Packet {
+	t.Helper()
+	select {
+	case p := <-a.events:
+		return p
+	case <-time.After(time.Second * 5):
+		t.Fatal("no event from the client")
+	}
+	return socketio.Packet{}
+}
+
+// nextCall returns the next event other than ReportHealth.
+func (a *fakeAuxProxy) nextCall(t *testing.T) (socketio.Packet, string, []byte) {
+	t.Helper()
+	for {
+		p := a.nextEvent(t)
+		name, payload := decodeCall(t, p)
+		if name != proto.MessageName(&pbuffer.ReportHealth{}) {
+			return p, name, payload
+		}
+	}
+}
+
+func (a *fakeAuxProxy) nextAck(t *testing.T) socketio.Packet {
+	t.Helper()
+	select {
+	case p := <-a.acks:
+		return p
+	case <-time.After(time.Second * 5):
+		t.Fatal("no ack from the client")
+	}
+	return socketio.Packet{}
+}
+
+func decodeCall(t *testing.T, p socketio.Packet) (string, []byte) {
+	t.Helper()
+	if len(p.Data) != 2 {
+		t.Fatal("event should have a name and a payload", p.Data)
+	}
+	var (
+		name    string
+		payload []byte
+	)
+	if err := json.Unmarshal(p.Data[0].(json.RawMessage), &name); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(p.Data[1].(json.RawMessage), &payload); err != nil {
+		t.Fatal("payload should be base64 encoded protobuf", err)
+	}
+	return name, payload
+}
+
+type recordingHandler struct {
+	health  bool
+	started chan *pbuffer.ActivateGameSession
+	updated chan *pbuffer.UpdateGameSession
+	ended   chan *pbuffer.TerminateProcess
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{
+		health:  true,
+		started: make(chan *pbuffer.ActivateGameSession, 10),
+		updated: make(chan *pbuffer.UpdateGameSession, 10),
+		ended:   make(chan *pbuffer.TerminateProcess, 10),
+	}
+}
+
+func (h *recordingHandler) StartGameSession(event *pbuffer.ActivateGameSession) { h.started <- event }
+func (h *recordingHandler) UpdateGameSession(event *pbuffer.UpdateGameSession)  { h.updated <- event }
+func (h *recordingHandler) ProcessTerminate(event *pbuffer.TerminateProcess)    { h.ended <- event }
+func (h *recordingHandler) HealthCheck() bool                                   { return h.health }
+
+func openClient(t *testing.T, a *fakeAuxProxy, opts ...Option) (Client, *recordingHandler) {
+	t.Helper()
+	h := newRecordingHandler()
+	c := NewClient(nopLogger{}, append([]Option{WithURL(a.URL())}, opts...)...)
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return c, h
+}
+
+func jsonpbString(t *testing.T, msg proto.Message) string {
+	t.Helper()
+	s, err := (&jsonpb.Marshaler{}).MarshalToString(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConformanceQuery(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+
+	os.Setenv("MAIN_PID", "12345")
+	defer os.Unsetenv("MAIN_PID")
+	openClient(t, a)
+	q := <-a.query
+	expect := map[string]string{
+		"pID":         "12345",
+		"sdkVersion":  "3.4.0",
+		"sdkLanguage": "Go",
+		"transport":   "websocket",
+		"b64":         "1",
+	}
+	for k, v := range expect {
+		if q.Get(k) != v {
+			t.Errorf("query %v mismatch: %q, expected %q", k, q.Get(k), v)
+		}
+	}
+
+	os.Unsetenv("MAIN_PID")
+	openClient(t, a)
+	q = <-a.query
+	if q.Get("pID") != fmt.Sprint(os.Getpid()) {
+		t.Error("pID should default to the process id", q.Get("pID"))
+	}
+}
+
+func TestConformanceCalls(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	c, _ := openClient(t, a)
+	<-a.query
+
+	tests := []struct {
+		req    proto.Message
+		resp   proto.Message
+		invoke func() (proto.Message, error)
+	}{}
+	add := func(req proto.Message, resp proto.Message, invoke func() (proto.Message, error)) {
+		tests = append(tests, struct {
+			req    proto.Message
+			resp   proto.Message
+			invoke func() (proto.Message, error)
+		}{req, resp, invoke})
+	}
+	noResult := func(err error) (proto.Message, error) { return nil, err }
+
+	processEnding := &pbuffer.ProcessEnding{}
+	add(processEnding, nil, func() (proto.Message, error) { return noResult(c.ProcessEnding(processEnding)) })
+	activate := &pbuffer.GameSessionActivate{GameSessionId: "gs", MaxPlayers: 4, Port: 7777}
+	add(activate, nil, func() (proto.Message, error) { return noResult(c.ActivateGameSession(activate)) })
+	terminate := &pbuffer.GameSessionTerminate{GameSessionId: "gs"}
+	add(terminate, nil, func() (proto.Message, error) { return noResult(c.TerminateGameSession(terminate)) })
+	backfill := &pbuffer.BackfillMatchmakingRequest{
+		TicketId:       "ticket",
+		GameSessionArn: "gs",
+		Players: []*pbuffer.Player{{
+			PlayerId:         "p1",
+			Team:             "red",
+			PlayerAttributes: map[string]*pbuffer.AttributeValue{"skill": {Type: 2, N: 10}},
+			LatencyInMs:      map[string]int32{"ap-northeast-1": 20},
+		}},
+	}
+	add(backfill, &pbuffer.BackfillMatchmakingResponse{TicketId: "ticket"}, func() (proto.Message, error) { return c.StartMatchBackfill(backfill) })
+	stop := &pbuffer.StopMatchmakingRequest{TicketId: "ticket", GameSessionArn: "gs", MatchmakingConfigurationArn: "config"}
+	add(stop, nil, func() (proto.Message, error) { return noResult(c.StopMatchBackfill(stop)) })
+	policy := &pbuffer.UpdatePlayerSessionCreationPolicy{GameSessionId: "gs", NewPlayerSessionCreationPolicy: "DENY_ALL"}
+	add(policy, nil, func() (proto.Message, error) { return noResult(c.UpdatePlayerSessionCreationPolicy(policy)) })
+	accept := &pbuffer.AcceptPlayerSession{GameSessionId: "gs", PlayerSessionId: "ps"}
+	add(accept, nil, func() (proto.Message, error) { return noResult(c.AcceptPlayerSession(accept)) })
+	remove := &pbuffer.RemovePlayerSession{GameSessionId: "gs", PlayerSessionId: "ps"}
+	add(remove, nil, func() (proto.Message, error) { return noResult(c.RemovePlayerSession(remove)) })
+	describe := &pbuffer.DescribePlayerSessionsRequest{GameSessionId: "gs", PlayerSessionStatusFilter: "ACTIVE", NextToken: "t", Limit: 10}
+	add(describe, &pbuffer.DescribePlayerSessionsResponse{
+		NextToken: "next",
+		PlayerSessions: []*pbuffer.PlayerSession{{
+			PlayerSessionId: "ps",
+			PlayerId:        "p1",
+			Status:          "ACTIVE",
+			CreationTime:    1600000000,
+			Port:            7777,
+		}},
+	}, func() (proto.Message, error) { return c.DescribePlayerSessions(describe) })
+	cert := &pbuffer.GetInstanceCertificate{}
+	add(cert, &pbuffer.GetInstanceCertificateResponse{
+		CertificatePath:      "/cert",
+		CertificateChainPath: "/chain",
+		PrivateKeyPath:       "/key",
+		HostName:             "host",
+		RootCertificatePath:  "/root",
+	}, func() (proto.Message, error) { return c.GetInstanceCertificate(cert) })
+	ready := &pbuffer.ProcessReady{LogPathsToUpload: []string{"/log"}, Port: 7777, MaxConcurrentGameSessions: 1}
+	add(ready, nil, func() (proto.Message, error) { return noResult(c.ProcessReady(ready)) })
+
+	for _, test := range tests {
+		name := proto.MessageName(test.req)
+		type result struct {
+			msg proto.Message
+			err error
+		}
+		done := make(chan result, 1)
+		go func() {
+			msg, err := test.invoke()
+			done <- result{msg, err}
+		}()
+
+		p, gotName, payload := a.nextCall(t)
+		if gotName != name {
+			t.Fatalf("event name mismatch: %v, expected %v", gotName, name)
+		}
+		if p.ID == nil {
+			t.Fatalf("%v should request an ack", name)
+		}
+		got := proto.Clone(test.req)
+		got.Reset()
+		if err := proto.Unmarshal(payload, got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(got, test.req) {
+			t.Errorf("%v payload mismatch: %v, expected %v", name, got, test.req)
+		}
+		if test.resp != nil {
+			a.ack(p, true, jsonpbString(t, test.resp))
+		} else {
+			a.ack(p, true)
+		}
+
+		select {
+		case r := <-done:
+			if r.err != nil {
+				t.Errorf("%v failed: %v", name, r.err)
+			}
+			if test.resp != nil && !proto.Equal(r.msg, test.resp) {
+				t.Errorf("%v result mismatch: %v, expected %v", name, r.msg, test.resp)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("%v did not return", name)
+		}
+	}
+}
+
+func TestConformanceErrors(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	c, _ := openClient(t, a)
+	<-a.query
+
+	for _, status := range []pbuffer.GameLiftResponse_Status{pbuffer.GameLiftResponse_ERROR_400, pbuffer.GameLiftResponse_ERROR_500} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{PlayerId: "p"})
+			done <- err
+		}()
+		p, _, _ := a.nextCall(t)
+		a.ack(p, false, jsonpbString(t, &pbuffer.GameLiftResponse{
+			Status:       status,
+			ErrorMessage: "message",
+			ResponseData: "data",
+		}))
+		err := <-done
+		ge, ok := err.(*GenericError)
+		if !ok {
+			t.Fatalf("error should be *GenericError: %#v", err)
+		}
+		if ge.GetStatus() != status || ge.GetErrorMessage() != "message" || ge.GetResponseData() != "data" {
+			t.Error("error mismatch", ge)
+		}
+		if ge.Error() != status.String()+":message:data" {
+			t.Error("error string mismatch", ge.Error())
+		}
+	}
+}
+
+func TestConformanceIncomingEvents(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	c, h := openClient(t, a)
+	<-a.query
+
+	emit := func(id int, name string, msg proto.Message) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.send(socketio.Packet{Type: socketio.Event, ID: &id, Data: []interface{}{name, string(data)}})
+	}
+	expectAck := func(id int) {
+		t.Helper()
+		p := a.nextAck(t)
+		if p.ID == nil || *p.ID != id {
+			t.Fatal("ack id mismatch", p.ID, id)
+		}
+		if len(p.Data) != 1 || string(p.Data[0].(json.RawMessage)) != "true" {
+			t.Error("ack should be [true]", p.Data)
+		}
+	}
+
+	// unknown events are ignored
+	emit(1, "Unknown", &pbuffer.ProcessEnding{})
+
+	start := &pbuffer.ActivateGameSession{GameSession: &pbuffer.GameSession{
+		GameSessionId:  "gs",
+		MaxPlayers:     4,
+		GameProperties: []*pbuffer.GameProperty{{Key: "k", Value: "v"}},
+		MatchmakerData: `{"matchId":"m"}`,
+	}}
+	emit(2, "StartGameSession", start)
+	expectAck(2)
+	if got := <-h.started; !proto.Equal(got, start) {
+		t.Error("StartGameSession mismatch", got, start)
+	}
+	if id := c.GetGameSessionId(); id == nil || *id != "gs" {
+		t.Error("game session id mismatch", id)
+	}
+
+	update := &pbuffer.UpdateGameSession{
+		GameSession:      &pbuffer.GameSession{GameSessionId: "gs", MaxPlayers: 8},
+		UpdateReason:     "MATCHMAKING_DATA_UPDATED",
+		BackfillTicketId: "ticket",
+	}
+	emit(3, "UpdateGameSession", update)
+	expectAck(3)
+	if got := <-h.updated; !proto.Equal(got, update) {
+		t.Error("UpdateGameSession mismatch", got, update)
+	}
+
+	terminate := &pbuffer.TerminateProcess{TerminationTime: 1600000000}
+	emit(4, "TerminateProcess", terminate)
+	expectAck(4)
+	if got := <-h.ended; !proto.Equal(got, terminate) {
+		t.Error("TerminateProcess mismatch", got, terminate)
+	}
+	if tt := c.GetTerminationTime(); tt == nil || tt.Unix() != 1600000000 {
+		t.Error("termination time mismatch", tt)
+	}
+}
+
+func TestConformanceHealth(t *testing.T) {
+	const (
+		pingInterval   = 50
+		healthInterval = time.Millisecond * 50
+	)
+	a := newFakeAuxProxy(pingInterval)
+	defer a.Close()
+	c, h := openClient(t, a, WithHealthCheckInterval(healthInterval))
+	<-a.query
+	h.health = false
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ProcessReady(&pbuffer.ProcessReady{Port: 7777})
+	}()
+	p, _, _ := a.nextCall(t)
+	a.ack(p, true)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	var times []time.Time
+	for len(times) < 3 {
+		p := a.nextEvent(t)
+		name, payload := decodeCall(t, p)
+		if name != proto.MessageName(&pbuffer.ReportHealth{}) {
+			t.Fatal("unexpected event", name)
+		}
+		if p.ID != nil {
+			t.Error("ReportHealth should not request an ack")
+		}
+		var health pbuffer.ReportHealth
+		if err := proto.Unmarshal(payload, &health); err != nil {
+			t.Fatal(err)
+		}
+		if health.GetHealthStatus() {
+			t.Error("health status should come from the handler")
+		}
+		times = append(times, time.Now())
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < healthInterval/2 {
+			t.Error("ReportHealth is sent too often", d)
+		}
+	}
+
+	// the client pings every pingInterval
+	first := <-a.pings
+	second := <-a.pings
+	if d := second.Sub(first); d < time.Millisecond*pingInterval/2 {
+		t.Error("ping is sent too often", d)
+	}
+}
+
+func TestConformanceInterceptor(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	var intercepted []string
+	c, _ := openClient(t, a, WithInterceptors(func(req proto.Message, resp proto.Message, invoker Invoker) error {
+		intercepted = append(intercepted, proto.MessageName(req))
+		return invoker(req, resp)
+	}))
+	<-a.query
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.AcceptPlayerSession(&pbuffer.AcceptPlayerSession{GameSessionId: "gs", PlayerSessionId: "ps"})
+	}()
+	p, _, _ := a.nextCall(t)
+	a.ack(p, true)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if len(intercepted) != 1 || intercepted[0] != proto.MessageName(&pbuffer.AcceptPlayerSession{}) {
+		t.Error("interceptor is not called", intercepted)
+	}
+}
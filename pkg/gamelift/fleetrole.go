@@ -0,0 +1,51 @@
+package gamelift
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// FleetRoleCredentialsGetter is implemented by the Clients of this package. GetFleetRoleCredentials is
+// only supported by the Server SDK 5 protocol, and fails with ErrorNotSupported on the auxproxy.
+//
+//	getter, ok := c.(gamelift.FleetRoleCredentialsGetter)
+type FleetRoleCredentialsGetter interface {
+	GetFleetRoleCredentials(event *GetFleetRoleCredentialsRequest) (*GetFleetRoleCredentialsResponse, error)
+}
+
+// fleetRoleTransport is implemented by transports whose SendAck accepts *GetFleetRoleCredentialsRequest.
+type fleetRoleTransport interface {
+	SupportsFleetRoleCredentials() bool
+}
+
+// GetFleetRoleCredentialsRequest asks for credentials of the IAM role attached to the fleet.
+// It has no counterpart in the auxproxy protocol, so it is defined here rather than in pbuffer,
+// and is not registered to the proto registry.
+type GetFleetRoleCredentialsRequest struct {
+	RoleArn         string `protobuf:"bytes,1,opt,name=roleArn,proto3" json:"roleArn,omitempty"`
+	RoleSessionName string `protobuf:"bytes,2,opt,name=roleSessionName,proto3" json:"roleSessionName,omitempty"`
+}
+
+func (m *GetFleetRoleCredentialsRequest) Reset()         { *m = GetFleetRoleCredentialsRequest{} }
+func (m *GetFleetRoleCredentialsRequest) String() string { return proto.CompactTextString(m) }
+func (*GetFleetRoleCredentialsRequest) ProtoMessage()    {}
+func (*GetFleetRoleCredentialsRequest) XXX_MessageName() string {
+	return "GetFleetRoleCredentialsRequest"
+}
+
+// GetFleetRoleCredentialsResponse is the temporary credentials of the fleet role.
+type GetFleetRoleCredentialsResponse struct {
+	AssumedRoleUserArn string `protobuf:"bytes,1,opt,name=assumedRoleUserArn,proto3" json:"assumedRoleUserArn,omitempty"`
+	AssumedRoleId      string `protobuf:"bytes,2,opt,name=assumedRoleId,proto3" json:"assumedRoleId,omitempty"`
+	AccessKeyId        string `protobuf:"bytes,3,opt,name=accessKeyId,proto3" json:"accessKeyId,omitempty"`
+	SecretAccessKey    string `protobuf:"bytes,4,opt,name=secretAccessKey,proto3" json:"secretAccessKey,omitempty"`
+	SessionToken       string `protobuf:"bytes,5,opt,name=sessionToken,proto3" json:"sessionToken,omitempty"`
+	// Expiration is the Unix time in seconds the credentials expire at.
+	Expiration int64 `protobuf:"varint,6,opt,name=expiration,proto3" json:"expiration,omitempty"`
+}
+
+func (m *GetFleetRoleCredentialsResponse) Reset()         { *m = GetFleetRoleCredentialsResponse{} }
+func (m *GetFleetRoleCredentialsResponse) String() string { return proto.CompactTextString(m) }
+func (*GetFleetRoleCredentialsResponse) ProtoMessage()    {}
+func (*GetFleetRoleCredentialsResponse) XXX_MessageName() string {
+	return "GetFleetRoleCredentialsResponse"
+}
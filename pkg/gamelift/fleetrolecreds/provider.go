@@ -0,0 +1,63 @@
+// Package fleetrolecreds provides aws-sdk-go credentials of the IAM role attached to the fleet,
+// retrieved with GetFleetRoleCredentials of the Server SDK.
+//
+//	creds := fleetrolecreds.NewCredentials(client.(gamelift.FleetRoleCredentialsGetter), "arn:aws:iam::123456789012:role/game-server")
+//	sess := session.Must(session.NewSession(&aws.Config{Credentials: creds}))
+package fleetrolecreds
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+)
+
+// ProviderName is the name of the provider set to credentials.Value.
+const ProviderName = "FleetRoleProvider"
+
+// DefaultExpiryWindow is the default ExpiryWindow of Provider.
+var DefaultExpiryWindow = time.Minute * 5
+
+// Provider retrieves credentials of the fleet role and caches them until ExpiryWindow before they expire.
+type Provider struct {
+	credentials.Expiry
+
+	Client          gamelift.FleetRoleCredentialsGetter
+	RoleArn         string
+	RoleSessionName string
+
+	// ExpiryWindow makes the credentials refreshed this long before they actually expire.
+	ExpiryWindow time.Duration
+}
+
+// NewCredentials returns credentials of the role roleArn retrieved through c.
+func NewCredentials(c gamelift.FleetRoleCredentialsGetter, roleArn string, options ...func(*Provider)) *credentials.Credentials {
+	p := &Provider{
+		Client:       c,
+		RoleArn:      roleArn,
+		ExpiryWindow: DefaultExpiryWindow,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return credentials.NewCredentials(p)
+}
+
+// Retrieve fetches new credentials of the fleet role.
+func (p *Provider) Retrieve() (credentials.Value, error) {
+	res, err := p.Client.GetFleetRoleCredentials(&gamelift.GetFleetRoleCredentialsRequest{
+		RoleArn:         p.RoleArn,
+		RoleSessionName: p.RoleSessionName,
+	})
+	if err != nil {
+		return credentials.Value{ProviderName: ProviderName}, err
+	}
+	p.SetExpiration(time.Unix(res.Expiration, 0), p.ExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     res.AccessKeyId,
+		SecretAccessKey: res.SecretAccessKey,
+		SessionToken:    res.SessionToken,
+		ProviderName:    ProviderName,
+	}, nil
+}
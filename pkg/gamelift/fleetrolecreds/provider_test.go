@@ -0,0 +1,61 @@
+package fleetrolecreds
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+	"github.com/neguse/gomelift/pkg/gamelift/mock"
+)
+
+func TestProvider(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := mock.NewClient()
+	n := 0
+	c.On("GetFleetRoleCredentials", func(req proto.Message) (proto.Message, error) {
+		n++
+		return &gamelift.GetFleetRoleCredentialsResponse{
+			AccessKeyId:     fmt.Sprint("AKID", n),
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Expiration:      now.Add(time.Hour).Unix(),
+		}, nil
+	})
+	creds := NewCredentials(c, "arn:aws:iam::123456789012:role/game-server", func(p *Provider) {
+		p.RoleSessionName = "session"
+		p.CurrentTime = func() time.Time { return now }
+	})
+
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.AccessKeyID != "AKID1" || v.SecretAccessKey != "secret" || v.SessionToken != "token" || v.ProviderName != ProviderName {
+		t.Error("credentials mismatch", v)
+	}
+	req := c.CallsTo("GetFleetRoleCredentials")[0].Request.(*gamelift.GetFleetRoleCredentialsRequest)
+	if req.RoleArn != "arn:aws:iam::123456789012:role/game-server" || req.RoleSessionName != "session" {
+		t.Error("request mismatch", req)
+	}
+
+	// cached until the expiry window
+	now = now.Add(time.Minute * 54)
+	if v, _ := creds.Get(); v.AccessKeyID != "AKID1" {
+		t.Error("credentials should be cached", v)
+	}
+	now = now.Add(time.Minute * 2)
+	if v, _ := creds.Get(); v.AccessKeyID != "AKID2" {
+		t.Error("credentials should be refreshed before expiry", v)
+	}
+
+	errFailed := errors.New("failed")
+	c.Return("GetFleetRoleCredentials", nil, errFailed)
+	creds.Expire()
+	if _, err := creds.Get(); err != errFailed {
+		t.Error("error mismatch", err)
+	}
+}
@@ -3,21 +3,20 @@ package gamelift
 import (
 	"encoding/json"
 	"fmt"
-	"net/url"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
 
+	"github.com/neguse/gomelift/pkg/eventio"
 	"github.com/neguse/gomelift/pkg/log"
 	"github.com/neguse/gomelift/pkg/proto/pbuffer"
-	"github.com/neguse/gomelift/pkg/socketio"
 )
 
 const (
-	healthCheckTimeout = 60
+	healthCheckTimeout = time.Second * 60
+	defaultURL         = "ws://127.0.0.1:5757/socket.io/"
 )
 
 type Handler interface {
@@ -48,91 +47,114 @@ type Client interface {
 }
 
 type client struct {
-	client               *socketio.Client
 	handler              Handler
 	isReady              bool
+	healthCheckInterval  time.Duration
 	logger               log.Logger
+	url                  string
+	interceptor          Interceptor
+	frameHook            eventio.FrameHook
+	lifecycle            func(e eventio.LifecycleEvent)
+	transport            Transport
 	gameSessionID        *string
 	processTerminateTime *time.Time
 }
 
-func NewClient(logger log.Logger) Client {
-	return &client{logger: logger}
+// Option configures a Client created by NewClient.
+type Option func(c *client)
+
+// WithInterceptors installs interceptors around every outgoing call.
+// The first interceptor is the outermost one.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *client) {
+		c.interceptor = ChainInterceptors(append([]Interceptor{c.interceptor}, interceptors...)...)
+	}
+}
+
+// WithURL sets the auxproxy endpoint. The default is ws://127.0.0.1:5757/socket.io/.
+func WithURL(u string) Option {
+	return func(c *client) {
+		c.url = u
+	}
+}
+
+// WithTransport sets the transport to the service. The default is the socket.io transport to the auxproxy at the URL set by WithURL.
+func WithTransport(t Transport) Option {
+	return func(c *client) {
+		c.transport = t
+	}
+}
+
+// WithFrameHook sets h to observe raw frames exchanged with the service, if the transport exposes them.
+func WithFrameHook(h eventio.FrameHook) Option {
+	return func(c *client) {
+		c.frameHook = h
+	}
+}
+
+// WithLifecycle sets fn to receive the lifecycle events of the connection to the service, such as
+// eventio.LifecycleDisconnected when the auxproxy is lost, or eventio.LifecycleReconnecting when the
+// Server SDK 5 service refreshes the connection, if the transport notifies them.
+// fn is called on the goroutines of the transport and should not block.
+func WithLifecycle(fn func(e eventio.LifecycleEvent)) Option {
+	return func(c *client) {
+		c.lifecycle = fn
+	}
+}
+
+// WithHealthCheckInterval sets the interval of ReportHealth. The default is 60 seconds as the official SDK.
+func WithHealthCheckInterval(d time.Duration) Option {
+	return func(c *client) {
+		c.healthCheckInterval = d
+	}
+}
+
+func NewClient(logger log.Logger, opts ...Option) Client {
+	c := &client{logger: logger, url: defaultURL, healthCheckInterval: healthCheckTimeout}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *client) Handle(h Handler) {
 	c.handler = h
 }
 
-func (c *client) HandleReceivedMessage(str string, msg interface{}, p *socketio.Packet) error {
-	err := json.Unmarshal([]byte(str), &msg)
-	if err != nil {
-		c.logger.Panic("failed to unmarshal Message", err)
+func (c *client) Open() error {
+	if c.transport == nil {
+		c.transport = NewSocketIOTransport(c.url, c.logger)
 	}
-	ackPacket := socketio.NewAckPacket(p, []interface{}{true})
-	if err := c.client.SendPacket(ackPacket); err != nil {
-		c.logger.Panic("failed to send ack packet", err)
+	if fh, ok := c.transport.(frameHooker); ok && c.frameHook != nil {
+		fh.HookFrame(c.frameHook)
 	}
-	return nil
+	if ln, ok := c.transport.(lifecycleNotifier); ok && c.lifecycle != nil {
+		ln.OnLifecycle(c.lifecycle)
+	}
+	c.transport.Subscribe(c.dispatch)
+	return c.transport.Open()
 }
 
-func (c *client) Open() error {
-	q := url.Values{}
-	if ppid := os.Getenv("MAIN_PID"); ppid != "" {
-		q.Set("pID", ppid)
-	} else {
-		q.Set("pID", fmt.Sprint(os.Getpid()))
+// dispatch updates the client state by an event from the service and passes it to the handler.
+func (c *client) dispatch(msg proto.Message) {
+	switch msg := msg.(type) {
+	case *pbuffer.ActivateGameSession:
+		c.gameSessionID = stringAddr(msg.GetGameSession().GetGameSessionId())
+		go c.handler.StartGameSession(msg)
+	case *pbuffer.UpdateGameSession:
+		go c.handler.UpdateGameSession(msg)
+	case *pbuffer.TerminateProcess:
+		c.processTerminateTime = timeAddr(time.Unix(msg.GetTerminationTime(), 0))
+		go c.handler.ProcessTerminate(msg)
 	}
-	q.Set("sdkVersion", "3.4.0")
-	q.Set("sdkLanguage", "Go")
-	u := "ws://127.0.0.1:5757/socket.io/?" + q.Encode()
-	c.client = socketio.NewClient(u, c.logger)
-	c.client.HandleFunc(func(p *socketio.Packet) {
-		name := string(p.Data[0].(json.RawMessage))
-		var str string
-		err := json.Unmarshal([]byte(p.Data[1].(json.RawMessage)), &str)
-		if err != nil {
-			c.logger.Panic("failed to unmarshal packet name", err)
-		}
-		switch name {
-		case `"StartGameSession"`:
-			msg := &pbuffer.ActivateGameSession{}
-			if err := c.HandleReceivedMessage(str, msg, p); err != nil {
-				c.logger.Panic("failed to parse received ActivateGameSession", err)
-			}
-			c.gameSessionID = stringAddr(msg.GetGameSession().GetGameSessionId())
-			go c.handler.StartGameSession(msg)
-		case `"UpdateGameSession"`:
-			msg := &pbuffer.UpdateGameSession{}
-			if err := c.HandleReceivedMessage(str, msg, p); err != nil {
-				c.logger.Panic("failed to parse received UpdateGameSession", err)
-			}
-			go c.handler.UpdateGameSession(msg)
-		case `"TerminateProcess"`:
-			msg := &pbuffer.TerminateProcess{}
-			if err := c.HandleReceivedMessage(str, msg, p); err != nil {
-				c.logger.Panic("failed to parse received TerminateProcess", err)
-			}
-			c.processTerminateTime = timeAddr(time.Unix(msg.GetTerminationTime(), 0))
-			go c.handler.ProcessTerminate(msg)
-		default:
-			c.logger.Log("unhandled packet", name)
-		}
-	})
-	return c.client.Open()
 }
 
 func (c *client) ReportHealth() {
 	// TODO: nonblocking
 	health := c.handler.HealthCheck()
-	event := &pbuffer.ReportHealth{HealthStatus: health}
-	data, err := proto.Marshal(event)
-	if err != nil {
-		c.logger.Panic("failed to marshal ReportHealth", err)
+	if err := c.transport.Send(&pbuffer.ReportHealth{HealthStatus: health}); err != nil {
+		c.logger.Log("failed to send ReportHealth", err)
 	}
-	var rmsg []interface{}
-	rmsg = append(rmsg, proto.MessageName(event), data)
-	c.client.Send(rmsg)
 }
 
 type GenericError struct {
@@ -174,51 +196,30 @@ func (c *client) ProcessReady(event *pbuffer.ProcessReady) error {
 	go func() {
 		for c.isReady {
 			c.ReportHealth()
-			time.Sleep(time.Second * healthCheckTimeout)
+			time.Sleep(c.healthCheckInterval)
 		}
 	}()
 	return nil
 }
 
 func (c *client) call(event proto.Message) error {
-	data, err := proto.Marshal(event)
-	if err != nil {
-		return err
-	}
-	var rmsg []interface{}
-	rmsg = append(rmsg, proto.MessageName(event), data)
-	ack, err := c.client.SendAck(rmsg)
-	if err != nil {
-		return err
-	}
-	if err := ParseGameLiftResponse(ack); err != nil {
-		return err
-	}
-	return nil
+	return c.invoke(event, nil)
 }
 
 func (c *client) callReturn(event proto.Message, result proto.Message) error {
-	data, err := proto.Marshal(event)
-	if err != nil {
-		return err
-	}
-	var rmsg []interface{}
-	rmsg = append(rmsg, proto.MessageName(event), data)
-	ack, err := c.client.SendAck(rmsg)
-	if err != nil {
-		return err
-	}
-	if err := ParseGameLiftResponse(ack); err != nil {
-		return err
-	}
-	var str string
-	if err := json.Unmarshal(ack[1].(json.RawMessage), &str); err != nil {
-		return err
-	}
-	if err := jsonpb.Unmarshal(strings.NewReader(str), result); err != nil {
-		return err
+	return c.invoke(event, result)
+}
+
+func (c *client) invoke(event proto.Message, result proto.Message) error {
+	if c.interceptor == nil {
+		return c.send(event, result)
 	}
-	return nil
+	return c.interceptor(event, result, c.send)
+}
+
+// send is the Invoker at the end of the interceptor chain.
+func (c *client) send(event proto.Message, result proto.Message) error {
+	return c.transport.SendAck(event, result)
 }
 
 func (c *client) ProcessEnding(event *pbuffer.ProcessEnding) error {
@@ -264,6 +265,15 @@ func (c *client) GetInstanceCertificate(event *pbuffer.GetInstanceCertificate) (
 	return result, c.callReturn(event, result)
 }
 
+// GetFleetRoleCredentials fails with ErrorNotSupported unless the transport supports it.
+func (c *client) GetFleetRoleCredentials(event *GetFleetRoleCredentialsRequest) (*GetFleetRoleCredentialsResponse, error) {
+	if t, ok := c.transport.(fleetRoleTransport); !ok || !t.SupportsFleetRoleCredentials() {
+		return nil, fmt.Errorf("%w: %v", ErrorNotSupported, proto.MessageName(event))
+	}
+	result := &GetFleetRoleCredentialsResponse{}
+	return result, c.callReturn(event, result)
+}
+
 func (c *client) GetGameSessionId() *string {
 	return c.gameSessionID
 }
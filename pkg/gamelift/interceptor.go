@@ -0,0 +1,42 @@
+package gamelift
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// Invoker sends req to the auxproxy and, when resp is not nil, fills resp from the reply.
+type Invoker func(req proto.Message, resp proto.Message) error
+
+// Interceptor intercepts an outgoing call such as ProcessReady or DescribePlayerSessions.
+// resp is nil for calls that have no response message.
+// An interceptor calls invoker to continue the call, or returns without calling it to short-circuit.
+type Interceptor func(req proto.Message, resp proto.Message, invoker Invoker) error
+
+// ChainInterceptors combines interceptors into one, the first being the outermost.
+// nil interceptors are skipped.
+func ChainInterceptors(interceptors ...Interceptor) Interceptor {
+	var chain []Interceptor
+	for _, i := range interceptors {
+		if i != nil {
+			chain = append(chain, i)
+		}
+	}
+	switch len(chain) {
+	case 0:
+		return nil
+	case 1:
+		return chain[0]
+	}
+	return func(req proto.Message, resp proto.Message, invoker Invoker) error {
+		return chain[0](req, resp, chainInvoker(chain[1:], invoker))
+	}
+}
+
+func chainInvoker(chain []Interceptor, invoker Invoker) Invoker {
+	if len(chain) == 0 {
+		return invoker
+	}
+	return func(req proto.Message, resp proto.Message) error {
+		return chain[0](req, resp, chainInvoker(chain[1:], invoker))
+	}
+}
@@ -0,0 +1,48 @@
+package gamelift
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+func TestChainInterceptors(t *testing.T) {
+	var order []string
+	record := func(name string) Interceptor {
+		return func(req proto.Message, resp proto.Message, invoker Invoker) error {
+			order = append(order, name+" before")
+			err := invoker(req, resp)
+			order = append(order, name+" after")
+			return err
+		}
+	}
+	errInvoke := errors.New("invoke")
+	invoker := func(req proto.Message, resp proto.Message) error {
+		order = append(order, "invoke "+proto.MessageName(req))
+		return errInvoke
+	}
+
+	i := ChainInterceptors(record("a"), nil, record("b"))
+	err := i(&pbuffer.ProcessEnding{}, nil, invoker)
+	if err != errInvoke {
+		t.Error("error mismatch", err, errInvoke)
+	}
+	expect := []string{
+		"a before",
+		"b before",
+		"invoke com.amazon.whitewater.auxproxy.pbuffer.ProcessEnding",
+		"b after",
+		"a after",
+	}
+	if !reflect.DeepEqual(order, expect) {
+		t.Error("order mismatch", order, expect)
+	}
+
+	if ChainInterceptors(nil, nil) != nil {
+		t.Error("empty chain should be nil")
+	}
+}
@@ -0,0 +1,227 @@
+// Package mock provides an in-memory gamelift.Client for unit testing game servers.
+package mock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+// Call is a recorded call to the Client.
+type Call struct {
+	// Method is the name of the gamelift.Client method, e.g. "ProcessReady".
+	Method  string
+	Request proto.Message
+}
+
+// Responder scripts the result of a method.
+// The returned message must be of the method's response type, or nil.
+type Responder func(req proto.Message) (proto.Message, error)
+
+// Client is a gamelift.Client which records calls instead of talking to the auxproxy.
+type Client struct {
+	mu                   sync.Mutex
+	handler              gamelift.Handler
+	opened               bool
+	calls                []Call
+	responders           map[string]Responder
+	gameSessionID        *string
+	processTerminateTime *time.Time
+}
+
+var (
+	_ gamelift.Client                     = (*Client)(nil)
+	_ gamelift.FleetRoleCredentialsGetter = (*Client)(nil)
+)
+
+func NewClient() *Client {
+	return &Client{
+		responders: make(map[string]Responder),
+	}
+}
+
+// On sets r to respond to calls of method.
+func (c *Client) On(method string, r Responder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responders[method] = r
+}
+
+// Return makes calls of method return resp and err.
+func (c *Client) Return(method string, resp proto.Message, err error) {
+	c.On(method, func(req proto.Message) (proto.Message, error) {
+		return resp, err
+	})
+}
+
+// Calls returns all recorded calls in order.
+func (c *Client) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Call(nil), c.calls...)
+}
+
+// CallsTo returns recorded calls of method in order.
+func (c *Client) CallsTo(method string) []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var calls []Call
+	for _, call := range c.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets recorded calls. Responders are kept.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = nil
+}
+
+func (c *Client) record(method string, req proto.Message, result proto.Message) error {
+	c.mu.Lock()
+	c.calls = append(c.calls, Call{Method: method, Request: proto.Clone(req)})
+	r := c.responders[method]
+	c.mu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	resp, err := r(req)
+	if resp != nil && result != nil {
+		if proto.MessageName(resp) != proto.MessageName(result) {
+			return fmt.Errorf("mock: %v must respond %v, not %v", method, proto.MessageName(result), proto.MessageName(resp))
+		}
+		proto.Merge(result, resp)
+	}
+	return err
+}
+
+// StartGameSession delivers event to the handler as the auxproxy would.
+// Unlike the real client, the handler is called synchronously.
+func (c *Client) StartGameSession(event *pbuffer.ActivateGameSession) {
+	c.mu.Lock()
+	id := event.GetGameSession().GetGameSessionId()
+	c.gameSessionID = &id
+	h := c.handler
+	c.mu.Unlock()
+	h.StartGameSession(event)
+}
+
+// UpdateGameSession delivers event to the handler synchronously.
+func (c *Client) UpdateGameSession(event *pbuffer.UpdateGameSession) {
+	c.mu.Lock()
+	h := c.handler
+	c.mu.Unlock()
+	h.UpdateGameSession(event)
+}
+
+// ProcessTerminate delivers event to the handler synchronously.
+func (c *Client) ProcessTerminate(event *pbuffer.TerminateProcess) {
+	c.mu.Lock()
+	t := time.Unix(event.GetTerminationTime(), 0)
+	c.processTerminateTime = &t
+	h := c.handler
+	c.mu.Unlock()
+	h.ProcessTerminate(event)
+}
+
+// HealthCheck asks the handler for its health.
+func (c *Client) HealthCheck() bool {
+	c.mu.Lock()
+	h := c.handler
+	c.mu.Unlock()
+	return h.HealthCheck()
+}
+
+// Opened reports whether Open has been called.
+func (c *Client) Opened() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opened
+}
+
+func (c *Client) Handle(h gamelift.Handler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handler = h
+}
+
+func (c *Client) Open() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opened = true
+	return nil
+}
+
+func (c *Client) ProcessReady(event *pbuffer.ProcessReady) error {
+	return c.record("ProcessReady", event, nil)
+}
+
+func (c *Client) ProcessEnding(event *pbuffer.ProcessEnding) error {
+	return c.record("ProcessEnding", event, nil)
+}
+
+func (c *Client) ActivateGameSession(event *pbuffer.GameSessionActivate) error {
+	return c.record("ActivateGameSession", event, nil)
+}
+
+func (c *Client) TerminateGameSession(event *pbuffer.GameSessionTerminate) error {
+	return c.record("TerminateGameSession", event, nil)
+}
+
+func (c *Client) StartMatchBackfill(event *pbuffer.BackfillMatchmakingRequest) (*pbuffer.BackfillMatchmakingResponse, error) {
+	result := &pbuffer.BackfillMatchmakingResponse{}
+	return result, c.record("StartMatchBackfill", event, result)
+}
+
+func (c *Client) StopMatchBackfill(event *pbuffer.StopMatchmakingRequest) error {
+	return c.record("StopMatchBackfill", event, nil)
+}
+
+func (c *Client) UpdatePlayerSessionCreationPolicy(event *pbuffer.UpdatePlayerSessionCreationPolicy) error {
+	return c.record("UpdatePlayerSessionCreationPolicy", event, nil)
+}
+
+func (c *Client) AcceptPlayerSession(event *pbuffer.AcceptPlayerSession) error {
+	return c.record("AcceptPlayerSession", event, nil)
+}
+
+func (c *Client) RemovePlayerSession(event *pbuffer.RemovePlayerSession) error {
+	return c.record("RemovePlayerSession", event, nil)
+}
+
+func (c *Client) DescribePlayerSessions(event *pbuffer.DescribePlayerSessionsRequest) (*pbuffer.DescribePlayerSessionsResponse, error) {
+	result := &pbuffer.DescribePlayerSessionsResponse{}
+	return result, c.record("DescribePlayerSessions", event, result)
+}
+
+func (c *Client) GetInstanceCertificate(event *pbuffer.GetInstanceCertificate) (*pbuffer.GetInstanceCertificateResponse, error) {
+	result := &pbuffer.GetInstanceCertificateResponse{}
+	return result, c.record("GetInstanceCertificate", event, result)
+}
+
+func (c *Client) GetFleetRoleCredentials(event *gamelift.GetFleetRoleCredentialsRequest) (*gamelift.GetFleetRoleCredentialsResponse, error) {
+	result := &gamelift.GetFleetRoleCredentialsResponse{}
+	return result, c.record("GetFleetRoleCredentials", event, result)
+}
+
+func (c *Client) GetGameSessionId() *string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gameSessionID
+}
+
+func (c *Client) GetTerminationTime() *time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.processTerminateTime
+}
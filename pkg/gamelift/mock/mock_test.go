@@ -0,0 +1,75 @@
+package mock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+type testHandler struct {
+	c gamelift.Client
+}
+
+func (h *testHandler) StartGameSession(event *pbuffer.ActivateGameSession) {
+	h.c.ActivateGameSession(&pbuffer.GameSessionActivate{
+		GameSessionId: event.GetGameSession().GetGameSessionId(),
+	})
+}
+
+func (h *testHandler) UpdateGameSession(event *pbuffer.UpdateGameSession) {}
+
+func (h *testHandler) ProcessTerminate(event *pbuffer.TerminateProcess) {
+	h.c.ProcessEnding(&pbuffer.ProcessEnding{})
+}
+
+func (h *testHandler) HealthCheck() bool { return true }
+
+func TestClient(t *testing.T) {
+	c := NewClient()
+	c.Handle(&testHandler{c: c})
+
+	c.StartGameSession(&pbuffer.ActivateGameSession{
+		GameSession: &pbuffer.GameSession{GameSessionId: "gs-1"},
+	})
+	if id := c.GetGameSessionId(); id == nil || *id != "gs-1" {
+		t.Error("game session id mismatch", id)
+	}
+	calls := c.CallsTo("ActivateGameSession")
+	if len(calls) != 1 || calls[0].Request.(*pbuffer.GameSessionActivate).GetGameSessionId() != "gs-1" {
+		t.Error("unexpected calls", calls)
+	}
+
+	errReject := errors.New("rejected")
+	c.Return("AcceptPlayerSession", nil, errReject)
+	if err := c.AcceptPlayerSession(&pbuffer.AcceptPlayerSession{}); err != errReject {
+		t.Error("error mismatch", err)
+	}
+
+	c.On("DescribePlayerSessions", func(req proto.Message) (proto.Message, error) {
+		return &pbuffer.DescribePlayerSessionsResponse{NextToken: req.(*pbuffer.DescribePlayerSessionsRequest).GetNextToken() + "+"}, nil
+	})
+	res, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{NextToken: "a"})
+	if err != nil || res.GetNextToken() != "a+" {
+		t.Error("unexpected response", res, err)
+	}
+
+	c.Return("GetInstanceCertificate", &pbuffer.ProcessEnding{}, nil)
+	if _, err := c.GetInstanceCertificate(&pbuffer.GetInstanceCertificate{}); err == nil {
+		t.Error("mismatched response type should fail")
+	}
+
+	c.ProcessTerminate(&pbuffer.TerminateProcess{TerminationTime: 100})
+	if tt := c.GetTerminationTime(); tt == nil || tt.Unix() != 100 {
+		t.Error("termination time mismatch", tt)
+	}
+	if len(c.CallsTo("ProcessEnding")) != 1 {
+		t.Error("ProcessEnding not called")
+	}
+	if len(c.Calls()) != 5 {
+		t.Error("call count mismatch", c.Calls())
+	}
+}
@@ -0,0 +1,723 @@
+package gamelift
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+const (
+	sdk5Version = "5.0.0"
+	// sdk5RequestTimeout limits the time to wait for the response of a request.
+	sdk5RequestTimeout = time.Second * 30
+	// sdk5RefreshAttempts is the number of attempts to reconnect when the service refreshes the connection,
+	// which are made sdk5RefreshDelay times the number of the failed attempts apart.
+	sdk5RefreshAttempts = 3
+	sdk5RefreshDelay    = time.Second
+)
+
+var (
+	ErrorNotSupported   = errors.New("not supported by the protocol")
+	ErrorDisconnected   = errors.New("disconnected from the service")
+	ErrorRequestTimeout = errors.New("request timed out")
+)
+
+// ServerParameters are the InitSDK parameters of the Server SDK 5 protocol.
+// On managed EC2 fleets they come from the environment of the process,
+// on Anywhere fleets from RegisterCompute and GetComputeAuthToken.
+type ServerParameters struct {
+	WebSocketURL string
+	ProcessID    string
+	HostID       string
+	FleetID      string
+	AuthToken    string
+}
+
+// NewClientSDK5 returns a Client speaking the Server SDK 5 websocket protocol.
+// TerminateGameSession is not part of the protocol and fails with ErrorNotSupported.
+// WithURL has no effect, the endpoint is params.WebSocketURL.
+func NewClientSDK5(logger log.Logger, params ServerParameters, opts ...Option) Client {
+	return NewClient(logger, append([]Option{WithTransport(NewSDK5Transport(params, logger))}, opts...)...)
+}
+
+// NewSDK5Transport returns the Transport of the Server SDK 5 websocket protocol.
+// It translates the messages of Server SDK 3/4 to the SDK 5 actions and back.
+// Requests without a response in 30 seconds fail with ErrorRequestTimeout.
+func NewSDK5Transport(params ServerParameters, logger log.Logger) Transport {
+	return &sdk5Transport{
+		params:         params,
+		logger:         logger,
+		requestTimeout: sdk5RequestTimeout,
+		refreshDelay:   sdk5RefreshDelay,
+		pending:        make(map[string]chan sdk5Response),
+	}
+}
+
+// sdk5Header is the envelope of every SDK 5 message.
+type sdk5Header struct {
+	Action       string `json:"Action"`
+	RequestID    string `json:"RequestId"`
+	StatusCode   int    `json:"StatusCode,omitempty"`
+	ErrorMessage string `json:"ErrorMessage,omitempty"`
+}
+
+type sdk5ActivateServerProcess struct {
+	sdk5Header
+	SdkVersion  string   `json:"SdkVersion"`
+	SdkLanguage string   `json:"SdkLanguage"`
+	Port        int32    `json:"Port"`
+	LogPaths    []string `json:"LogPaths"`
+}
+
+type sdk5GameSessionRequest struct {
+	sdk5Header
+	GameSessionID       string `json:"GameSessionId"`
+	PlayerSessionID     string `json:"PlayerSessionId,omitempty"`
+	PlayerSessionPolicy string `json:"PlayerSessionPolicy,omitempty"`
+}
+
+type sdk5DescribePlayerSessions struct {
+	sdk5Header
+	GameSessionID             string `json:"GameSessionId,omitempty"`
+	PlayerID                  string `json:"PlayerId,omitempty"`
+	PlayerSessionID           string `json:"PlayerSessionId,omitempty"`
+	PlayerSessionStatusFilter string `json:"PlayerSessionStatusFilter,omitempty"`
+	NextToken                 string `json:"NextToken,omitempty"`
+	Limit                     int32  `json:"Limit,omitempty"`
+}
+
+type sdk5PlayerSession struct {
+	PlayerSessionID string `json:"PlayerSessionId"`
+	PlayerID        string `json:"PlayerId"`
+	GameSessionID   string `json:"GameSessionId"`
+	FleetID         string `json:"FleetId"`
+	IPAddress       string `json:"IpAddress"`
+	Status          string `json:"Status"`
+	CreationTime    int64  `json:"CreationTime"`
+	TerminationTime int64  `json:"TerminationTime"`
+	Port            int32  `json:"Port"`
+	PlayerData      string `json:"PlayerData"`
+	DNSName         string `json:"DnsName"`
+}
+
+type sdk5DescribePlayerSessionsResult struct {
+	NextToken      string              `json:"NextToken"`
+	PlayerSessions []sdk5PlayerSession `json:"PlayerSessions"`
+}
+
+type sdk5AttributeValue struct {
+	AttrType string             `json:"AttrType"`
+	S        *string            `json:"S,omitempty"`
+	N        *float64           `json:"N,omitempty"`
+	SL       []string           `json:"SL,omitempty"`
+	SDM      map[string]float64 `json:"SDM,omitempty"`
+}
+
+type sdk5Player struct {
+	PlayerID         string                        `json:"PlayerId"`
+	PlayerAttributes map[string]sdk5AttributeValue `json:"PlayerAttributes,omitempty"`
+	Team             string                        `json:"Team,omitempty"`
+	LatencyInMs      map[string]int32              `json:"LatencyInMs,omitempty"`
+}
+
+type sdk5MatchBackfill struct {
+	sdk5Header
+	TicketID                    string       `json:"TicketId"`
+	GameSessionArn              string       `json:"GameSessionArn"`
+	MatchmakingConfigurationArn string       `json:"MatchmakingConfigurationArn"`
+	Players                     []sdk5Player `json:"Players,omitempty"`
+}
+
+type sdk5MatchBackfillResult struct {
+	TicketID string `json:"TicketId"`
+}
+
+type sdk5ComputeCertificateResult struct {
+	CertificatePath string `json:"CertificatePath"`
+	ComputeName     string `json:"ComputeName"`
+}
+
+type sdk5FleetRoleCredentials struct {
+	sdk5Header
+	RoleArn         string `json:"RoleArn"`
+	RoleSessionName string `json:"RoleSessionName,omitempty"`
+}
+
+type sdk5FleetRoleCredentialsResult struct {
+	AssumedRoleUserArn string `json:"AssumedRoleUserArn"`
+	AssumedRoleID      string `json:"AssumedRoleId"`
+	AccessKeyID        string `json:"AccessKeyId"`
+	SecretAccessKey    string `json:"SecretAccessKey"`
+	SessionToken       string `json:"SessionToken"`
+	// Expiration is in milliseconds since the epoch.
+	Expiration int64 `json:"Expiration"`
+}
+
+type sdk5Heartbeat struct {
+	sdk5Header
+	HealthStatus bool `json:"HealthStatus"`
+}
+
+type sdk5GameSession struct {
+	GameSessionID             string            `json:"GameSessionId"`
+	GameSessionName           string            `json:"GameSessionName"`
+	FleetID                   string            `json:"FleetId"`
+	MaximumPlayerSessionCount int32             `json:"MaximumPlayerSessionCount"`
+	Port                      int32             `json:"Port"`
+	IPAddress                 string            `json:"IpAddress"`
+	GameSessionData           string            `json:"GameSessionData"`
+	MatchmakerData            string            `json:"MatchmakerData"`
+	GameProperties            map[string]string `json:"GameProperties"`
+	DNSName                   string            `json:"DnsName"`
+}
+
+type sdk5CreateGameSession struct {
+	sdk5Header
+	sdk5GameSession
+}
+
+type sdk5UpdateGameSession struct {
+	sdk5Header
+	GameSession      sdk5GameSession `json:"GameSession"`
+	UpdateReason     string          `json:"UpdateReason"`
+	BackfillTicketID string          `json:"BackfillTicketId"`
+}
+
+type sdk5TerminateProcess struct {
+	sdk5Header
+	// TerminationTime is in milliseconds since the epoch.
+	TerminationTime int64 `json:"TerminationTime"`
+}
+
+type sdk5RefreshConnection struct {
+	sdk5Header
+	RefreshConnectionEndpoint string `json:"RefreshConnectionEndpoint"`
+	AuthToken                 string `json:"AuthToken"`
+}
+
+type sdk5Response struct {
+	data []byte
+	err  error
+}
+
+// sdk5Transport is a connection to the Server SDK 5 websocket endpoint.
+// Requests carry a RequestId which the response echoes, messages without a known RequestId are pushed by the service.
+type sdk5Transport struct {
+	logger         log.Logger
+	frameHook      eventio.FrameHook
+	handle         func(msg proto.Message)
+	lifecycle      func(e eventio.LifecycleEvent)
+	requestTimeout time.Duration
+	refreshDelay   time.Duration
+
+	mu sync.Mutex
+	// params are replaced when the service refreshes the connection.
+	params ServerParameters
+	ws     *websocket.Conn
+	// pending are the requests sent on ws waiting for their responses.
+	pending map[string]chan sdk5Response
+
+	writeMu sync.Mutex
+}
+
+func (s *sdk5Transport) url() (string, error) {
+	s.mu.Lock()
+	params := s.params
+	s.mu.Unlock()
+	u, err := url.Parse(params.WebSocketURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("pID", params.ProcessID)
+	q.Set("sdkVersion", sdk5Version)
+	q.Set("sdkLanguage", "Go")
+	q.Set("Authorization", params.AuthToken)
+	q.Set("ComputeId", params.HostID)
+	q.Set("FleetId", params.FleetID)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// HookFrame sets h to observe raw websocket frames. It should be called before Open.
+func (s *sdk5Transport) HookFrame(h eventio.FrameHook) {
+	s.frameHook = h
+}
+
+// OnLifecycle sets fn to receive the lifecycle events of the connection. It should be called before Open.
+// When the service asks to refresh the connection, LifecycleReconnecting is emitted before each attempt
+// to reconnect, and LifecycleConnected again for the new connection.
+func (s *sdk5Transport) OnLifecycle(fn func(e eventio.LifecycleEvent)) {
+	s.lifecycle = fn
+}
+
+func (s *sdk5Transport) emit(e eventio.LifecycleEvent) {
+	if s.lifecycle != nil {
+		s.lifecycle(e)
+	}
+}
+
+func (s *sdk5Transport) Subscribe(h func(event proto.Message)) {
+	s.handle = h
+}
+
+func (s *sdk5Transport) Close() error {
+	s.mu.Lock()
+	ws := s.ws
+	s.ws = nil
+	pending := s.pending
+	s.pending = make(map[string]chan sdk5Response)
+	s.mu.Unlock()
+	for _, ch := range pending {
+		ch <- sdk5Response{err: ErrorDisconnected}
+	}
+	if ws == nil {
+		return nil
+	}
+	s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleDisconnected, Reason: eventio.ReasonClientClose})
+	return ws.Close()
+}
+
+func (s *sdk5Transport) SupportsFleetRoleCredentials() bool {
+	return true
+}
+
+func (s *sdk5Transport) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ws != nil
+}
+
+func (s *sdk5Transport) Open() error {
+	u, err := s.url()
+	if err != nil {
+		return err
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	old := s.ws
+	s.ws = ws
+	// the responses of the requests on the old connection never arrive on the new one
+	pending := s.pending
+	s.pending = make(map[string]chan sdk5Response)
+	s.mu.Unlock()
+	for _, ch := range pending {
+		ch <- sdk5Response{err: fmt.Errorf("%w: connection refreshed", ErrorDisconnected)}
+	}
+	if old != nil {
+		old.Close()
+	}
+	s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleConnected})
+	go s.read(ws)
+	return nil
+}
+
+func (s *sdk5Transport) read(ws *websocket.Conn) {
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			s.mu.Lock()
+			current := s.ws == ws
+			var pending map[string]chan sdk5Response
+			if current {
+				s.ws = nil
+				pending = s.pending
+				s.pending = make(map[string]chan sdk5Response)
+			}
+			s.mu.Unlock()
+			if current {
+				s.logger.Log("sdk5 connection closed", err)
+				for _, ch := range pending {
+					ch <- sdk5Response{err: fmt.Errorf("%w: %v", ErrorDisconnected, err)}
+				}
+				s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleDisconnected, Reason: eventio.DisconnectReason(err), Err: err})
+			}
+			return
+		}
+		if s.frameHook != nil {
+			s.frameHook(eventio.Inbound, string(data))
+		}
+		s.receive(data)
+	}
+}
+
+func (s *sdk5Transport) receive(data []byte) {
+	var h sdk5Header
+	if err := json.Unmarshal(data, &h); err != nil {
+		s.logger.Log("failed to unmarshal sdk5 message", err)
+		s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleError, Err: err})
+		return
+	}
+	s.mu.Lock()
+	ch, ok := s.pending[h.RequestID]
+	delete(s.pending, h.RequestID)
+	s.mu.Unlock()
+	if ok {
+		var res sdk5Response
+		if h.StatusCode != 0 && h.StatusCode != 200 {
+			res.err = sdk5Error(h)
+		} else {
+			res.data = data
+		}
+		ch <- res
+		return
+	}
+
+	msg, err := decodeSDK5Push(h.Action, data)
+	if err != nil {
+		s.logger.Log("failed to decode sdk5 message", h.Action, err)
+		s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleError, Err: err})
+		return
+	}
+	switch msg := msg.(type) {
+	case nil:
+		s.logger.Log("unhandled sdk5 message", h.Action)
+	case *sdk5RefreshConnection:
+		s.mu.Lock()
+		s.params.WebSocketURL = msg.RefreshConnectionEndpoint
+		s.params.AuthToken = msg.AuthToken
+		s.mu.Unlock()
+		s.refresh()
+	case proto.Message:
+		if s.handle != nil {
+			s.handle(msg)
+		}
+	}
+}
+
+// refresh reconnects to the endpoint the service asked to. The current connection is kept until
+// the new one is opened.
+func (s *sdk5Transport) refresh() {
+	var err error
+	for attempt := 1; attempt <= sdk5RefreshAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(s.refreshDelay * time.Duration(attempt-1))
+		}
+		s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleReconnecting, Attempt: attempt})
+		if err = s.Open(); err == nil {
+			return
+		}
+		s.logger.Log("failed to refresh sdk5 connection", attempt, err)
+	}
+	s.emit(eventio.LifecycleEvent{Type: eventio.LifecycleError, Err: err})
+}
+
+func sdk5Error(h sdk5Header) error {
+	status := pbuffer.GameLiftResponse_ERROR_500
+	if h.StatusCode >= 400 && h.StatusCode < 500 {
+		status = pbuffer.GameLiftResponse_ERROR_400
+	}
+	return &GenericError{pbuffer.GameLiftResponse{Status: status, ErrorMessage: h.ErrorMessage}}
+}
+
+func (s *sdk5Transport) write(msg interface{}) error {
+	s.mu.Lock()
+	ws := s.ws
+	s.mu.Unlock()
+	return s.writeTo(ws, msg)
+}
+
+func (s *sdk5Transport) writeTo(ws *websocket.Conn, msg interface{}) error {
+	if ws == nil {
+		return ErrorDisconnected
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if s.frameHook != nil {
+		s.frameHook(eventio.Outbound, string(data))
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return ws.WriteMessage(websocket.TextMessage, data)
+}
+
+// request sends msg whose header is h and waits for the response up to the request timeout.
+// The request fails with ErrorDisconnected if the connection is closed or refreshed meanwhile.
+func (s *sdk5Transport) request(h *sdk5Header, msg interface{}) ([]byte, error) {
+	h.RequestID = xid.New().String()
+	ch := make(chan sdk5Response, 1)
+	s.mu.Lock()
+	// the request is pending on the connection it is written to
+	ws := s.ws
+	s.pending[h.RequestID] = ch
+	s.mu.Unlock()
+	if err := s.writeTo(ws, msg); err != nil {
+		s.cancel(h.RequestID)
+		return nil, err
+	}
+	timer := time.NewTimer(s.requestTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.data, res.err
+	case <-timer.C:
+		s.cancel(h.RequestID)
+		return nil, fmt.Errorf("%w: %s", ErrorRequestTimeout, h.Action)
+	}
+}
+
+func (s *sdk5Transport) cancel(requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, requestID)
+}
+
+// Send sends event without waiting for the response. ReportHealth is sent as HeartbeatServerProcess.
+func (s *sdk5Transport) Send(event proto.Message) error {
+	if e, ok := event.(*pbuffer.ReportHealth); ok {
+		msg := &sdk5Heartbeat{sdk5Header: sdk5Header{Action: "HeartbeatServerProcess", RequestID: xid.New().String()}, HealthStatus: e.GetHealthStatus()}
+		return s.write(msg)
+	}
+	h, msg, err := sdk5Request(event)
+	if err != nil {
+		return err
+	}
+	h.RequestID = xid.New().String()
+	return s.write(msg)
+}
+
+// SendAck translates an SDK 3/4 message to its SDK 5 action, and the response back to result.
+func (s *sdk5Transport) SendAck(event proto.Message, result proto.Message) error {
+	h, msg, err := sdk5Request(event)
+	if err != nil {
+		return err
+	}
+	data, err := s.request(h, msg)
+	if err != nil {
+		return err
+	}
+	return decodeSDK5Result(data, result)
+}
+
+// sdk5Request returns the SDK 5 action of event and its header.
+func sdk5Request(event proto.Message) (*sdk5Header, interface{}, error) {
+	var (
+		h   *sdk5Header
+		msg interface{}
+	)
+	switch e := event.(type) {
+	case *pbuffer.ProcessReady:
+		m := &sdk5ActivateServerProcess{SdkVersion: sdk5Version, SdkLanguage: "Go", Port: e.GetPort(), LogPaths: e.GetLogPathsToUpload()}
+		m.Action = "ActivateServerProcess"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.ProcessEnding:
+		m := &sdk5Header{Action: "TerminateServerProcess"}
+		h, msg = m, m
+	case *pbuffer.GameSessionActivate:
+		m := &sdk5GameSessionRequest{GameSessionID: e.GetGameSessionId()}
+		m.Action = "ActivateGameSession"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.UpdatePlayerSessionCreationPolicy:
+		m := &sdk5GameSessionRequest{GameSessionID: e.GetGameSessionId(), PlayerSessionPolicy: e.GetNewPlayerSessionCreationPolicy()}
+		m.Action = "UpdatePlayerSessionCreationPolicy"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.AcceptPlayerSession:
+		m := &sdk5GameSessionRequest{GameSessionID: e.GetGameSessionId(), PlayerSessionID: e.GetPlayerSessionId()}
+		m.Action = "AcceptPlayerSession"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.RemovePlayerSession:
+		m := &sdk5GameSessionRequest{GameSessionID: e.GetGameSessionId(), PlayerSessionID: e.GetPlayerSessionId()}
+		m.Action = "RemovePlayerSession"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.DescribePlayerSessionsRequest:
+		m := &sdk5DescribePlayerSessions{
+			GameSessionID:             e.GetGameSessionId(),
+			PlayerID:                  e.GetPlayerId(),
+			PlayerSessionID:           e.GetPlayerSessionId(),
+			PlayerSessionStatusFilter: e.GetPlayerSessionStatusFilter(),
+			NextToken:                 e.GetNextToken(),
+			Limit:                     e.GetLimit(),
+		}
+		m.Action = "DescribePlayerSessions"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.BackfillMatchmakingRequest:
+		m := &sdk5MatchBackfill{
+			TicketID:                    e.GetTicketId(),
+			GameSessionArn:              e.GetGameSessionArn(),
+			MatchmakingConfigurationArn: e.GetMatchmakingConfigurationArn(),
+			Players:                     sdk5Players(e.GetPlayers()),
+		}
+		m.Action = "StartMatchBackfill"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.StopMatchmakingRequest:
+		m := &sdk5MatchBackfill{
+			TicketID:                    e.GetTicketId(),
+			GameSessionArn:              e.GetGameSessionArn(),
+			MatchmakingConfigurationArn: e.GetMatchmakingConfigurationArn(),
+		}
+		m.Action = "StopMatchBackfill"
+		h, msg = &m.sdk5Header, m
+	case *pbuffer.GetInstanceCertificate:
+		m := &sdk5Header{Action: "GetComputeCertificate"}
+		h, msg = m, m
+	case *GetFleetRoleCredentialsRequest:
+		m := &sdk5FleetRoleCredentials{RoleArn: e.RoleArn, RoleSessionName: e.RoleSessionName}
+		m.Action = "GetFleetRoleCredentials"
+		h, msg = &m.sdk5Header, m
+	default:
+		return nil, nil, fmt.Errorf("%w: %v", ErrorNotSupported, proto.MessageName(event))
+	}
+	return h, msg, nil
+}
+
+func decodeSDK5Result(data []byte, result proto.Message) error {
+	switch r := result.(type) {
+	case nil:
+		return nil
+	case *pbuffer.DescribePlayerSessionsResponse:
+		var res sdk5DescribePlayerSessionsResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		r.NextToken = res.NextToken
+		for _, ps := range res.PlayerSessions {
+			r.PlayerSessions = append(r.PlayerSessions, &pbuffer.PlayerSession{
+				PlayerSessionId: ps.PlayerSessionID,
+				PlayerId:        ps.PlayerID,
+				GameSessionId:   ps.GameSessionID,
+				FleetId:         ps.FleetID,
+				IpAddress:       ps.IPAddress,
+				Status:          ps.Status,
+				CreationTime:    ps.CreationTime,
+				TerminationTime: ps.TerminationTime,
+				Port:            ps.Port,
+				PlayerData:      ps.PlayerData,
+				DnsName:         ps.DNSName,
+			})
+		}
+	case *pbuffer.BackfillMatchmakingResponse:
+		var res sdk5MatchBackfillResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		r.TicketId = res.TicketID
+	case *pbuffer.GetInstanceCertificateResponse:
+		var res sdk5ComputeCertificateResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		r.CertificatePath = res.CertificatePath
+		r.HostName = res.ComputeName
+	case *GetFleetRoleCredentialsResponse:
+		var res sdk5FleetRoleCredentialsResult
+		if err := json.Unmarshal(data, &res); err != nil {
+			return err
+		}
+		r.AssumedRoleUserArn = res.AssumedRoleUserArn
+		r.AssumedRoleId = res.AssumedRoleID
+		r.AccessKeyId = res.AccessKeyID
+		r.SecretAccessKey = res.SecretAccessKey
+		r.SessionToken = res.SessionToken
+		r.Expiration = res.Expiration / int64(time.Second/time.Millisecond)
+	default:
+		return fmt.Errorf("%w: %v", ErrorNotSupported, proto.MessageName(result))
+	}
+	return nil
+}
+
+// sdk5AttrTypes maps AttributeValue.Type to the SDK 5 AttrType.
+var sdk5AttrTypes = map[int32]string{1: "STRING", 2: "DOUBLE", 3: "STRING_LIST", 4: "STRING_DOUBLE_MAP"}
+
+func sdk5Players(players []*pbuffer.Player) []sdk5Player {
+	var ps []sdk5Player
+	for _, p := range players {
+		sp := sdk5Player{PlayerID: p.GetPlayerId(), Team: p.GetTeam(), LatencyInMs: p.GetLatencyInMs()}
+		for name, attr := range p.GetPlayerAttributes() {
+			if sp.PlayerAttributes == nil {
+				sp.PlayerAttributes = make(map[string]sdk5AttributeValue)
+			}
+			v := sdk5AttributeValue{AttrType: sdk5AttrTypes[attr.GetType()]}
+			switch v.AttrType {
+			case "STRING":
+				v.S = stringAddr(attr.GetS())
+			case "DOUBLE":
+				n := attr.GetN()
+				v.N = &n
+			case "STRING_LIST":
+				v.SL = attr.GetSL()
+			case "STRING_DOUBLE_MAP":
+				v.SDM = attr.GetSDM()
+			}
+			sp.PlayerAttributes[name] = v
+		}
+		ps = append(ps, sp)
+	}
+	return ps
+}
+
+// decodeSDK5Push decodes a message pushed by the service.
+// It returns nil for unknown actions.
+func decodeSDK5Push(action string, data []byte) (interface{}, error) {
+	switch action {
+	case "CreateGameSession":
+		var m sdk5CreateGameSession
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return &pbuffer.ActivateGameSession{GameSession: m.sdk5GameSession.proto()}, nil
+	case "UpdateGameSession":
+		var m sdk5UpdateGameSession
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return &pbuffer.UpdateGameSession{
+			GameSession:      m.GameSession.proto(),
+			UpdateReason:     m.UpdateReason,
+			BackfillTicketId: m.BackfillTicketID,
+		}, nil
+	case "TerminateProcess":
+		var m sdk5TerminateProcess
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return &pbuffer.TerminateProcess{TerminationTime: m.TerminationTime / int64(time.Second/time.Millisecond)}, nil
+	case "RefreshConnection":
+		var m sdk5RefreshConnection
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return &m, nil
+	}
+	return nil, nil
+}
+
+func (gs *sdk5GameSession) proto() *pbuffer.GameSession {
+	var keys []string
+	for k := range gs.GameProperties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var props []*pbuffer.GameProperty
+	for _, k := range keys {
+		props = append(props, &pbuffer.GameProperty{Key: k, Value: gs.GameProperties[k]})
+	}
+	return &pbuffer.GameSession{
+		GameSessionId:   gs.GameSessionID,
+		FleetId:         gs.FleetID,
+		Name:            gs.GameSessionName,
+		MaxPlayers:      gs.MaximumPlayerSessionCount,
+		GameProperties:  props,
+		IpAddress:       gs.IPAddress,
+		Port:            gs.Port,
+		GameSessionData: gs.GameSessionData,
+		MatchmakerData:  gs.MatchmakerData,
+		DnsName:         gs.DNSName,
+	}
+}
@@ -0,0 +1,423 @@
+package gamelift
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+// fakeSDK5 stands in for the Server SDK 5 websocket endpoint.
+type fakeSDK5 struct {
+	server *httptest.Server
+	query  chan url.Values
+	recv   chan map[string]interface{}
+
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func newFakeSDK5() *fakeSDK5 {
+	f := &fakeSDK5{query: make(chan url.Values, 10), recv: make(chan map[string]interface{}, 100)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fakeSDK5) URL() string {
+	return strings.Replace(f.server.URL, "http", "ws", 1)
+}
+
+func (f *fakeSDK5) Close() {
+	f.server.Close()
+}
+
+func (f *fakeSDK5) serve(w http.ResponseWriter, r *http.Request) {
+	var upgrader websocket.Upgrader
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.conn = conn
+	f.mu.Unlock()
+	f.query <- r.URL.Query()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg map[string]interface{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return
+		}
+		f.recv <- msg
+	}
+}
+
+func (f *fakeSDK5) write(t *testing.T, msg interface{}) {
+	t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (f *fakeSDK5) next(t *testing.T) map[string]interface{} {
+	t.Helper()
+	select {
+	case msg := <-f.recv:
+		return msg
+	case <-time.After(time.Second * 5):
+		t.Fatal("no message from the client")
+	}
+	return nil
+}
+
+// respond answers req with StatusCode 200 and the result fields.
+func (f *fakeSDK5) respond(t *testing.T, req map[string]interface{}, result map[string]interface{}) {
+	t.Helper()
+	res := map[string]interface{}{"Action": req["Action"], "RequestId": req["RequestId"], "StatusCode": 200}
+	for k, v := range result {
+		res[k] = v
+	}
+	f.write(t, res)
+}
+
+func openSDK5(t *testing.T, f *fakeSDK5, opts ...Option) (Client, *recordingHandler) {
+	t.Helper()
+	params := ServerParameters{
+		WebSocketURL: f.URL(),
+		ProcessID:    "process-1",
+		HostID:       "compute-1",
+		FleetID:      "fleet-1",
+		AuthToken:    "token-1",
+	}
+	c := NewClientSDK5(nopLogger{}, params, opts...)
+	h := newRecordingHandler()
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	return c, h
+}
+
+func TestSDK5(t *testing.T) {
+	f := newFakeSDK5()
+	defer f.Close()
+	c, h := openSDK5(t, f, WithHealthCheckInterval(time.Hour))
+
+	q := <-f.query
+	expectQuery := map[string]string{
+		"pID":           "process-1",
+		"sdkVersion":    sdk5Version,
+		"sdkLanguage":   "Go",
+		"Authorization": "token-1",
+		"ComputeId":     "compute-1",
+		"FleetId":       "fleet-1",
+	}
+	for k, v := range expectQuery {
+		if q.Get(k) != v {
+			t.Errorf("query %v mismatch: %q, expected %q", k, q.Get(k), v)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.ProcessReady(&pbuffer.ProcessReady{Port: 7777, LogPathsToUpload: []string{"/local/game/log"}})
+	}()
+	req := f.next(t)
+	if req["Action"] != "ActivateServerProcess" || req["Port"] != 7777.0 || req["SdkVersion"] != sdk5Version ||
+		!reflect.DeepEqual(req["LogPaths"], []interface{}{"/local/game/log"}) || req["RequestId"] == "" {
+		t.Errorf("ActivateServerProcess mismatch: %v", req)
+	}
+	f.respond(t, req, nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if hb := f.next(t); hb["Action"] != "HeartbeatServerProcess" || hb["HealthStatus"] != true {
+		t.Errorf("heartbeat mismatch: %v", hb)
+	}
+
+	f.write(t, map[string]interface{}{
+		"Action":                    "CreateGameSession",
+		"RequestId":                 "push-1",
+		"GameSessionId":             "gsess-1",
+		"GameSessionName":           "name",
+		"FleetId":                   "fleet-1",
+		"MaximumPlayerSessionCount": 8,
+		"Port":                      7777,
+		"IpAddress":                 "127.0.0.1",
+		"GameProperties":            map[string]string{"b": "2", "a": "1"},
+	})
+	select {
+	case e := <-h.started:
+		gs := e.GetGameSession()
+		if gs.GetGameSessionId() != "gsess-1" || gs.GetName() != "name" || gs.GetMaxPlayers() != 8 ||
+			len(gs.GetGameProperties()) != 2 || gs.GetGameProperties()[0].GetKey() != "a" {
+			t.Errorf("game session mismatch: %v", gs)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no StartGameSession")
+	}
+	if id := c.GetGameSessionId(); id == nil || *id != "gsess-1" {
+		t.Errorf("game session ID mismatch: %v", id)
+	}
+
+	go func() {
+		done <- c.AcceptPlayerSession(&pbuffer.AcceptPlayerSession{GameSessionId: "gsess-1", PlayerSessionId: "psess-1"})
+	}()
+	req = f.next(t)
+	if req["Action"] != "AcceptPlayerSession" || req["GameSessionId"] != "gsess-1" || req["PlayerSessionId"] != "psess-1" {
+		t.Errorf("AcceptPlayerSession mismatch: %v", req)
+	}
+	f.write(t, map[string]interface{}{"Action": "AcceptPlayerSession", "RequestId": req["RequestId"], "StatusCode": 400, "ErrorMessage": "invalid"})
+	err := <-done
+	var ge *GenericError
+	if !errors.As(err, &ge) || ge.GetStatus() != pbuffer.GameLiftResponse_ERROR_400 || ge.GetErrorMessage() != "invalid" {
+		t.Errorf("error mismatch: %v", err)
+	}
+
+	type describeResult struct {
+		res *pbuffer.DescribePlayerSessionsResponse
+		err error
+	}
+	described := make(chan describeResult, 1)
+	go func() {
+		res, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{GameSessionId: "gsess-1", Limit: 10})
+		described <- describeResult{res, err}
+	}()
+	req = f.next(t)
+	if req["Action"] != "DescribePlayerSessions" || req["GameSessionId"] != "gsess-1" || req["Limit"] != 10.0 {
+		t.Errorf("DescribePlayerSessions mismatch: %v", req)
+	}
+	f.respond(t, req, map[string]interface{}{
+		"NextToken":      "next",
+		"PlayerSessions": []map[string]interface{}{{"PlayerSessionId": "psess-1", "PlayerId": "player-1", "Status": "ACTIVE"}},
+	})
+	d := <-described
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+	if d.res.GetNextToken() != "next" || len(d.res.GetPlayerSessions()) != 1 ||
+		d.res.GetPlayerSessions()[0].GetPlayerId() != "player-1" || d.res.GetPlayerSessions()[0].GetStatus() != "ACTIVE" {
+		t.Errorf("DescribePlayerSessions result mismatch: %v", d.res)
+	}
+
+	if err := c.TerminateGameSession(&pbuffer.GameSessionTerminate{GameSessionId: "gsess-1"}); !errors.Is(err, ErrorNotSupported) {
+		t.Errorf("TerminateGameSession should not be supported: %v", err)
+	}
+
+	f.write(t, map[string]interface{}{"Action": "TerminateProcess", "RequestId": "push-2", "TerminationTime": 1600000000000})
+	select {
+	case e := <-h.ended:
+		if e.GetTerminationTime() != 1600000000 {
+			t.Errorf("termination time mismatch: %v", e.GetTerminationTime())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no ProcessTerminate")
+	}
+
+	go func() {
+		done <- c.ProcessEnding(&pbuffer.ProcessEnding{})
+	}()
+	req = f.next(t)
+	if req["Action"] != "TerminateServerProcess" {
+		t.Errorf("TerminateServerProcess mismatch: %v", req)
+	}
+	f.mu.Lock()
+	f.conn.Close()
+	f.mu.Unlock()
+	if err := <-done; !errors.Is(err, ErrorDisconnected) {
+		t.Errorf("pending request should fail on disconnect: %v", err)
+	}
+}
+
+func TestSDK5FleetRoleCredentials(t *testing.T) {
+	f := newFakeSDK5()
+	defer f.Close()
+	c, _ := openSDK5(t, f)
+	<-f.query
+
+	type credsResult struct {
+		res *GetFleetRoleCredentialsResponse
+		err error
+	}
+	done := make(chan credsResult, 1)
+	go func() {
+		res, err := c.(FleetRoleCredentialsGetter).GetFleetRoleCredentials(&GetFleetRoleCredentialsRequest{RoleArn: "arn:role", RoleSessionName: "session"})
+		done <- credsResult{res, err}
+	}()
+	req := f.next(t)
+	if req["Action"] != "GetFleetRoleCredentials" || req["RoleArn"] != "arn:role" || req["RoleSessionName"] != "session" {
+		t.Errorf("GetFleetRoleCredentials mismatch: %v", req)
+	}
+	f.respond(t, req, map[string]interface{}{
+		"AssumedRoleUserArn": "arn:user",
+		"AssumedRoleId":      "role-id",
+		"AccessKeyId":        "AKID",
+		"SecretAccessKey":    "secret",
+		"SessionToken":       "token",
+		"Expiration":         1600000000000,
+	})
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	expect := &GetFleetRoleCredentialsResponse{
+		AssumedRoleUserArn: "arn:user",
+		AssumedRoleId:      "role-id",
+		AccessKeyId:        "AKID",
+		SecretAccessKey:    "secret",
+		SessionToken:       "token",
+		Expiration:         1600000000,
+	}
+	if !reflect.DeepEqual(r.res, expect) {
+		t.Errorf("credentials mismatch: %v, expected %v", r.res, expect)
+	}
+}
+
+func TestSocketIOFleetRoleCredentials(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	c, _ := openClient(t, a)
+	if _, err := c.(FleetRoleCredentialsGetter).GetFleetRoleCredentials(&GetFleetRoleCredentialsRequest{RoleArn: "arn:role"}); !errors.Is(err, ErrorNotSupported) {
+		t.Error("GetFleetRoleCredentials should not be supported by the auxproxy", err)
+	}
+}
+
+func TestSDK5PendingRequest(t *testing.T) {
+	f := newFakeSDK5()
+	defer f.Close()
+	s := NewSDK5Transport(ServerParameters{WebSocketURL: f.URL(), AuthToken: "token-1"}, nopLogger{}).(*sdk5Transport)
+	s.requestTimeout = time.Millisecond * 50
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	<-f.query
+
+	h := &sdk5Header{Action: "TerminateServerProcess"}
+	if _, err := s.request(h, h); !errors.Is(err, ErrorRequestTimeout) {
+		t.Errorf("request should time out: %v", err)
+	}
+	f.next(t)
+
+	s.requestTimeout = time.Hour
+	done := make(chan error, 1)
+	go func() {
+		h := &sdk5Header{Action: "TerminateServerProcess"}
+		_, err := s.request(h, h)
+		done <- err
+	}()
+	f.next(t)
+	f.write(t, map[string]interface{}{"Action": "RefreshConnection", "RefreshConnectionEndpoint": f.URL(), "AuthToken": "token-2"})
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrorDisconnected) {
+			t.Errorf("pending request should fail on refresh: %v", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("pending request hangs on refresh")
+	}
+	if q := <-f.query; q.Get("Authorization") != "token-2" {
+		t.Errorf("refreshed query mismatch: %v", q)
+	}
+}
+
+func TestSDK5RefreshAttempts(t *testing.T) {
+	f := newFakeSDK5()
+	defer f.Close()
+	s := NewSDK5Transport(ServerParameters{WebSocketURL: f.URL()}, nopLogger{}).(*sdk5Transport)
+	s.refreshDelay = time.Millisecond
+	events := make(chan eventio.LifecycleEvent, 10)
+	s.OnLifecycle(func(e eventio.LifecycleEvent) {
+		events <- e
+	})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	<-f.query
+	<-events
+
+	// nothing listens on the refreshed endpoint
+	unused := httptest.NewServer(http.NotFoundHandler())
+	unused.Close()
+	f.write(t, map[string]interface{}{"Action": "RefreshConnection", "RefreshConnectionEndpoint": strings.Replace(unused.URL, "http", "ws", 1), "AuthToken": "token-2"})
+	for attempt := 1; attempt <= sdk5RefreshAttempts; attempt++ {
+		select {
+		case e := <-events:
+			if e.Type != eventio.LifecycleReconnecting || e.Attempt != attempt {
+				t.Error("reconnecting event mismatch", e)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("no reconnecting event")
+		}
+	}
+	select {
+	case e := <-events:
+		if e.Type != eventio.LifecycleError || e.Err == nil {
+			t.Error("error event mismatch", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no error event")
+	}
+	if !s.Connected() {
+		t.Error("the current connection should be kept")
+	}
+}
+
+func TestSDK5Lifecycle(t *testing.T) {
+	f := newFakeSDK5()
+	defer f.Close()
+	events := make(chan eventio.LifecycleEvent, 10)
+	openSDK5(t, f, WithHealthCheckInterval(time.Hour), WithLifecycle(func(e eventio.LifecycleEvent) {
+		events <- e
+	}))
+	<-f.query
+	next := func() eventio.LifecycleEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second * 5):
+			t.Fatal("no lifecycle event")
+		}
+		return eventio.LifecycleEvent{}
+	}
+	if e := next(); e.Type != eventio.LifecycleConnected {
+		t.Error("connected event mismatch", e)
+	}
+
+	f.write(t, map[string]interface{}{"Action": "RefreshConnection", "RefreshConnectionEndpoint": f.URL(), "AuthToken": "token-2"})
+	if e := next(); e.Type != eventio.LifecycleReconnecting || e.Attempt != 1 {
+		t.Error("reconnecting event mismatch", e)
+	}
+	if e := next(); e.Type != eventio.LifecycleConnected {
+		t.Error("connected event mismatch", e)
+	}
+	<-f.query
+
+	f.mu.Lock()
+	f.conn.Close()
+	f.mu.Unlock()
+	if e := next(); e.Type != eventio.LifecycleDisconnected || e.Err == nil {
+		t.Error("disconnected event mismatch", e)
+	}
+}
@@ -0,0 +1,162 @@
+package gamelift
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+// Transport carries messages between a Client and the GameLift service.
+type Transport interface {
+	// Open connects to the service.
+	Open() error
+	// Close disconnects from the service.
+	Close() error
+	// Connected reports whether the transport is connected to the service.
+	Connected() bool
+	// Send sends event without waiting for the response.
+	Send(event proto.Message) error
+	// SendAck sends event and waits for the response, which is decoded into result unless result is nil.
+	// An error response is returned as *GenericError.
+	SendAck(event proto.Message, result proto.Message) error
+	// Subscribe sets h to receive the events pushed by the service,
+	// which are *pbuffer.ActivateGameSession, *pbuffer.UpdateGameSession and *pbuffer.TerminateProcess.
+	// It should be called before Open.
+	Subscribe(h func(event proto.Message))
+}
+
+// frameHooker is implemented by transports exposing their raw frames.
+type frameHooker interface {
+	HookFrame(h eventio.FrameHook)
+}
+
+// lifecycleNotifier is implemented by transports notifying the lifecycle events of their connections.
+type lifecycleNotifier interface {
+	OnLifecycle(fn func(e eventio.LifecycleEvent))
+}
+
+type socketioTransport struct {
+	url       string
+	logger    log.Logger
+	client    *socketio.Client
+	handle    func(event proto.Message)
+	frameHook eventio.FrameHook
+	lifecycle func(e eventio.LifecycleEvent)
+}
+
+// NewSocketIOTransport returns the Transport of the Server SDK 3/4 auxproxy protocol, connecting to the auxproxy at u.
+func NewSocketIOTransport(u string, logger log.Logger) Transport {
+	return &socketioTransport{url: u, logger: logger}
+}
+
+// HookFrame sets h to observe raw Engine.IO frames. It should be called before Open.
+func (t *socketioTransport) HookFrame(h eventio.FrameHook) {
+	t.frameHook = h
+}
+
+// OnLifecycle sets fn to receive the lifecycle events of the connection. It should be called before Open.
+func (t *socketioTransport) OnLifecycle(fn func(e eventio.LifecycleEvent)) {
+	t.lifecycle = fn
+}
+
+func (t *socketioTransport) Subscribe(h func(event proto.Message)) {
+	t.handle = h
+}
+
+func (t *socketioTransport) Open() error {
+	q := url.Values{}
+	if ppid := os.Getenv("MAIN_PID"); ppid != "" {
+		q.Set("pID", ppid)
+	} else {
+		q.Set("pID", fmt.Sprint(os.Getpid()))
+	}
+	q.Set("sdkVersion", "3.4.0")
+	q.Set("sdkLanguage", "Go")
+	u := t.url + "?" + q.Encode()
+	t.client = socketio.NewClient(u, t.logger)
+	if t.frameHook != nil {
+		t.client.HookFrame(t.frameHook)
+	}
+	if t.lifecycle != nil {
+		t.client.OnLifecycle(t.lifecycle)
+	}
+	t.client.On("StartGameSession", func(str string) bool {
+		return t.receive(str, &pbuffer.ActivateGameSession{})
+	})
+	t.client.On("UpdateGameSession", func(str string) bool {
+		return t.receive(str, &pbuffer.UpdateGameSession{})
+	})
+	t.client.On("TerminateProcess", func(str string) bool {
+		return t.receive(str, &pbuffer.TerminateProcess{})
+	})
+	t.client.HandleFunc(func(p *socketio.Packet) {
+		t.logger.Log("unhandled packet", socketio.EventName(p))
+	})
+	return t.client.Open()
+}
+
+// receive decodes an event pushed by the auxproxy and passes it to the subscriber.
+// The returned true is the ack of the event.
+func (t *socketioTransport) receive(str string, msg proto.Message) bool {
+	if err := json.Unmarshal([]byte(str), msg); err != nil {
+		t.logger.Panic("failed to parse received "+proto.MessageName(msg), err)
+	}
+	if t.handle != nil {
+		t.handle(msg)
+	}
+	return true
+}
+
+func (t *socketioTransport) Close() error {
+	if t.client == nil {
+		return nil
+	}
+	return t.client.Close()
+}
+
+func (t *socketioTransport) Connected() bool {
+	return t.client != nil && t.client.Connected()
+}
+
+func (t *socketioTransport) Send(event proto.Message) error {
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return t.client.Send([]interface{}{proto.MessageName(event), data})
+}
+
+func (t *socketioTransport) SendAck(event proto.Message, result proto.Message) error {
+	data, err := proto.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ack, err := t.client.SendAck([]interface{}{proto.MessageName(event), data})
+	if err != nil {
+		return err
+	}
+	if err := ParseGameLiftResponse(ack); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	var str string
+	if err := json.Unmarshal(ack[1].(json.RawMessage), &str); err != nil {
+		return err
+	}
+	if err := jsonpb.Unmarshal(strings.NewReader(str), result); err != nil {
+		return err
+	}
+	return nil
+}
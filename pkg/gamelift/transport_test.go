@@ -0,0 +1,168 @@
+package gamelift
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+// pipeTransport is an in-memory Transport answering calls with respond.
+type pipeTransport struct {
+	mu        sync.Mutex
+	sent      []proto.Message
+	connected bool
+	handle    func(event proto.Message)
+	respond   func(event proto.Message, result proto.Message) error
+}
+
+func (p *pipeTransport) Open() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connected = true
+	return nil
+}
+
+func (p *pipeTransport) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connected = false
+	return nil
+}
+
+func (p *pipeTransport) Connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connected
+}
+
+func (p *pipeTransport) Send(event proto.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent = append(p.sent, event)
+	return nil
+}
+
+func (p *pipeTransport) SendAck(event proto.Message, result proto.Message) error {
+	p.Send(event)
+	return p.respond(event, result)
+}
+
+func (p *pipeTransport) Subscribe(h func(event proto.Message)) {
+	p.handle = h
+}
+
+func (p *pipeTransport) messages() []proto.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]proto.Message(nil), p.sent...)
+}
+
+func TestTransport(t *testing.T) {
+	p := &pipeTransport{respond: func(event proto.Message, result proto.Message) error {
+		if r, ok := result.(*pbuffer.BackfillMatchmakingResponse); ok {
+			r.TicketId = "ticket"
+		}
+		return nil
+	}}
+	c := NewClient(nopLogger{}, WithTransport(p), WithHealthCheckInterval(time.Hour))
+	h := newRecordingHandler()
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Connected() || p.handle == nil {
+		t.Fatal("transport should be opened and subscribed")
+	}
+
+	if err := c.ProcessReady(&pbuffer.ProcessReady{Port: 7777}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.StartMatchBackfill(&pbuffer.BackfillMatchmakingRequest{})
+	if err != nil || res.GetTicketId() != "ticket" {
+		t.Error("StartMatchBackfill mismatch", res, err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for len(p.messages()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	names := map[string]bool{}
+	for _, m := range p.messages() {
+		names[proto.MessageName(m)] = true
+	}
+	for _, m := range []proto.Message{&pbuffer.ProcessReady{}, &pbuffer.ReportHealth{}, &pbuffer.BackfillMatchmakingRequest{}} {
+		if !names[proto.MessageName(m)] {
+			t.Error("not sent", proto.MessageName(m))
+		}
+	}
+
+	p.handle(&pbuffer.ActivateGameSession{GameSession: &pbuffer.GameSession{GameSessionId: "gsess-1"}})
+	select {
+	case <-h.started:
+	case <-time.After(time.Second * 5):
+		t.Fatal("no StartGameSession")
+	}
+	if id := c.GetGameSessionId(); id == nil || *id != "gsess-1" {
+		t.Error("game session ID mismatch", id)
+	}
+}
+
+func TestSocketIOTransportConnected(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	tr := NewSocketIOTransport(a.URL(), nopLogger{})
+	if tr.Connected() {
+		t.Error("should not be connected before Open")
+	}
+	if err := tr.Open(); err != nil {
+		t.Fatal(err)
+	}
+	<-a.query
+	if !tr.Connected() {
+		t.Error("should be connected after Open")
+	}
+	if err := tr.Close(); err != nil {
+		t.Error(err)
+	}
+	if tr.Connected() {
+		t.Error("should not be connected after Close")
+	}
+}
+
+func TestLifecycle(t *testing.T) {
+	a := newFakeAuxProxy(25000)
+	defer a.Close()
+	events := make(chan eventio.LifecycleEvent, 10)
+	c := NewClient(nopLogger{}, WithURL(a.URL()), WithLifecycle(func(e eventio.LifecycleEvent) {
+		events <- e
+	}))
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	<-a.query
+	select {
+	case e := <-events:
+		if e.Type != eventio.LifecycleConnected || e.SID != "sid" {
+			t.Error("connected event mismatch", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no connected event")
+	}
+
+	// losing the auxproxy
+	a.mu.Lock()
+	a.conn.Close()
+	a.mu.Unlock()
+	select {
+	case e := <-events:
+		if e.Type != eventio.LifecycleDisconnected || e.Err == nil || e.Reason == eventio.ReasonClientClose {
+			t.Error("disconnected event mismatch", e)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no disconnected event")
+	}
+}
@@ -0,0 +1,487 @@
+package localfleet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/websocket"
+	"github.com/rs/xid"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/gamelift"
+	"github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+const (
+	pingInterval = 25000
+	pingTimeout  = 60000
+)
+
+var (
+	ErrorAckTimeout   = errors.New("timed out waiting for ack")
+	ErrorAckRejected  = errors.New("ack rejected by process")
+	ErrorDisconnected = errors.New("process disconnected")
+)
+
+var upgrader = websocket.Upgrader{}
+
+// conn is the auxproxy side of a socket.io connection from a server process.
+type conn struct {
+	id     string
+	ws     *websocket.Conn
+	logger log.Logger
+
+	writeMu sync.Mutex
+
+	ackMu  sync.Mutex
+	reqID  int
+	acks   map[int]chan []interface{}
+	closed chan struct{}
+}
+
+func newConn(id string, ws *websocket.Conn, logger log.Logger) *conn {
+	return &conn{
+		id:     id,
+		ws:     ws,
+		logger: logger,
+		acks:   make(map[int]chan []interface{}),
+		closed: make(chan struct{}),
+	}
+}
+
+func (c *conn) write(p eventio.Packet) error {
+	data, err := eventio.EncodePacket(p)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *conn) send(p socketio.Packet) error {
+	s, err := socketio.EncodePacket(p)
+	if err != nil {
+		return err
+	}
+	return c.write(eventio.Packet{Type: eventio.Message, Data: s})
+}
+
+// emitAck sends an event and waits for its ack.
+func (c *conn) emitAck(data []interface{}, timeout time.Duration) ([]interface{}, error) {
+	c.ackMu.Lock()
+	c.reqID++
+	id := c.reqID
+	ch := make(chan []interface{}, 1)
+	c.acks[id] = ch
+	c.ackMu.Unlock()
+	defer func() {
+		c.ackMu.Lock()
+		delete(c.acks, id)
+		c.ackMu.Unlock()
+	}()
+
+	if err := c.send(socketio.Packet{Type: socketio.Event, ID: &id, Data: data}); err != nil {
+		return nil, err
+	}
+	select {
+	case ack := <-ch:
+		return ack, nil
+	case <-c.closed:
+		return nil, ErrorDisconnected
+	case <-time.After(timeout):
+		return nil, ErrorAckTimeout
+	}
+}
+
+// push sends an auxproxy message such as StartGameSession to the process and waits for its ack.
+func (c *conn) push(name string, msg proto.Message) error {
+	if c == nil {
+		return ErrorDisconnected
+	}
+	data, err := pushData(name, msg)
+	if err != nil {
+		return err
+	}
+	ack, err := c.emitAck(data, ackTimeout)
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if len(ack) == 0 {
+		return ErrorAckRejected
+	}
+	if err := json.Unmarshal(ack[0].(json.RawMessage), &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return ErrorAckRejected
+	}
+	return nil
+}
+
+func pushData(name string, msg proto.Message) ([]interface{}, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{name, string(data)}, nil
+}
+
+// writeRaw writes a text frame as is, bypassing the encoders.
+func (c *conn) writeRaw(frame string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(frame))
+}
+
+// abort closes the underlying connection without a close frame.
+func (c *conn) abort() {
+	c.ws.UnderlyingConn().Close()
+}
+
+func (c *conn) serve(handle func(c *conn, p *socketio.Packet)) error {
+	defer close(c.closed)
+	for {
+		typ, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if typ != websocket.TextMessage {
+			continue
+		}
+		ep, err := eventio.ParsePacket(string(data))
+		if err != nil {
+			c.logger.Log("failed to parse packet", err)
+			continue
+		}
+		switch ep.Type {
+		case eventio.Ping:
+			if err := c.write(eventio.Packet{Type: eventio.Pong, Data: ep.Data}); err != nil {
+				return err
+			}
+		case eventio.Close:
+			return nil
+		case eventio.Message:
+			p, err := socketio.DecodePacket(ep.Data)
+			if err != nil {
+				c.logger.Log("failed to decode packet", err)
+				continue
+			}
+			switch p.Type {
+			case socketio.Event:
+				handle(c, &p)
+			case socketio.Ack:
+				if p.ID == nil {
+					continue
+				}
+				c.ackMu.Lock()
+				if ch, ok := c.acks[*p.ID]; ok {
+					select {
+					case ch <- p.Data:
+					default:
+					}
+				}
+				c.ackMu.Unlock()
+			case socketio.Disconnect:
+				return nil
+			}
+		}
+	}
+}
+
+// AuxProxy returns the handler server processes connect to, usually mounted on /socket.io/.
+func (f *Fleet) AuxProxy() http.Handler {
+	return http.HandlerFunc(f.serveAuxProxy)
+}
+
+func (f *Fleet) serveAuxProxy(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		f.logger.Log("failed to upgrade", err)
+		return
+	}
+	defer ws.Close()
+
+	sid := xid.New().String()
+	c := newConn(sid, ws, f.logger)
+	open, err := json.Marshal(eventio.OpenResponse{
+		Sid:          sid,
+		Upgrades:     []string{},
+		PingInterval: pingInterval,
+		PingTimeout:  pingTimeout,
+	})
+	if err != nil {
+		f.logger.Panic("failed to marshal OpenResponse", err)
+	}
+	if err := c.write(eventio.Packet{Type: eventio.Open, Data: string(open)}); err != nil {
+		f.logger.Log("failed to send open", err)
+		return
+	}
+	if err := c.send(socketio.Packet{Type: socketio.Connect}); err != nil {
+		f.logger.Log("failed to send connect", err)
+		return
+	}
+
+	q := r.URL.Query()
+	f.connect(sid, q.Get("pID"), q.Get("sdkVersion"), c)
+	defer f.disconnect(sid)
+	f.logger.Log("process connected", sid, q.Get("pID"))
+
+	if err := c.serve(f.handleEvent); err != nil {
+		f.logger.Log("process disconnected", sid, err)
+	}
+}
+
+func (f *Fleet) handleEvent(c *conn, p *socketio.Packet) {
+	name, msg, err := decodeEvent(p)
+	var rule *FaultRule
+	if err == nil {
+		rule = f.faults.pick(name, p.ID != nil)
+	}
+	if rule != nil {
+		f.logger.Log("injecting fault", rule.Action, name)
+		switch rule.Action {
+		case FaultClose:
+			c.abort()
+			return
+		case FaultError400:
+			err = faultError(pbuffer.GameLiftResponse_ERROR_400, rule)
+		case FaultError500:
+			err = faultError(pbuffer.GameLiftResponse_ERROR_500, rule)
+		}
+	}
+	var result proto.Message
+	if err == nil {
+		result, err = f.handleMessage(c.id, msg)
+	}
+	if p.ID == nil {
+		if err != nil {
+			f.logger.Log("failed to handle event", err)
+		}
+		return
+	}
+	var data []interface{}
+	if err != nil {
+		data = []interface{}{false, errorResponse(err)}
+	} else if result != nil {
+		s, err := (&jsonpb.Marshaler{}).MarshalToString(result)
+		if err != nil {
+			f.logger.Panic("failed to marshal response", err)
+		}
+		data = []interface{}{true, s}
+	} else {
+		data = []interface{}{true}
+	}
+	ack := socketio.NewAckPacket(p, data)
+	if rule == nil {
+		if err := c.send(ack); err != nil {
+			f.logger.Log("failed to send ack", err)
+		}
+		return
+	}
+	switch rule.Action {
+	case FaultDelay:
+		go func() {
+			time.Sleep(rule.delay())
+			if err := c.send(ack); err != nil {
+				f.logger.Log("failed to send delayed ack", err)
+			}
+		}()
+	case FaultDrop:
+	case FaultMalformed:
+		if err := c.writeRaw(malformed(ack)); err != nil {
+			f.logger.Log("failed to send malformed ack", err)
+		}
+	case FaultDuplicate:
+		for i := 0; i < 2; i++ {
+			if err := c.send(ack); err != nil {
+				f.logger.Log("failed to send ack", err)
+			}
+		}
+	default:
+		if err := c.send(ack); err != nil {
+			f.logger.Log("failed to send ack", err)
+		}
+	}
+}
+
+// push sends an auxproxy message to a process, injecting faults.
+func (f *Fleet) push(c *conn, name string, msg proto.Message) error {
+	rule := f.faults.pick(name, true)
+	if rule == nil {
+		return c.push(name, msg)
+	}
+	if c == nil {
+		return ErrorDisconnected
+	}
+	f.logger.Log("injecting fault", rule.Action, name)
+	switch rule.Action {
+	case FaultDelay:
+		time.Sleep(rule.delay())
+	case FaultDrop:
+		return nil
+	case FaultClose:
+		c.abort()
+		return ErrorDisconnected
+	case FaultMalformed:
+		data, err := pushData(name, msg)
+		if err != nil {
+			return err
+		}
+		return c.writeRaw(malformed(socketio.Packet{Type: socketio.Event, Data: data}))
+	case FaultDuplicate:
+		data, err := pushData(name, msg)
+		if err != nil {
+			return err
+		}
+		if err := c.send(socketio.Packet{Type: socketio.Event, Data: data}); err != nil {
+			return err
+		}
+	}
+	return c.push(name, msg)
+}
+
+func faultError(status pbuffer.GameLiftResponse_Status, rule *FaultRule) error {
+	msg := rule.ErrorMessage
+	if msg == "" {
+		msg = "injected fault"
+	}
+	return &gamelift.GenericError{GameLiftResponse: pbuffer.GameLiftResponse{
+		Status:       status,
+		ErrorMessage: msg,
+	}}
+}
+
+// malformed encodes p as a message frame and truncates it in the middle of its JSON.
+func malformed(p socketio.Packet) string {
+	s, err := socketio.EncodePacket(p)
+	if err != nil {
+		return "4"
+	}
+	return "4" + s[:len(s)-len(s)/3-1]
+}
+
+func decodeEvent(p *socketio.Packet) (string, proto.Message, error) {
+	if len(p.Data) < 2 {
+		return "", nil, badRequest("event should have a name and a payload")
+	}
+	var (
+		name    string
+		payload []byte
+	)
+	if err := json.Unmarshal(p.Data[0].(json.RawMessage), &name); err != nil {
+		return "", nil, badRequest("invalid event name: %v", err)
+	}
+	if err := json.Unmarshal(p.Data[1].(json.RawMessage), &payload); err != nil {
+		return name, nil, badRequest("invalid payload: %v", err)
+	}
+	t := proto.MessageType(name)
+	if t == nil {
+		return name, nil, badRequest("unknown message %v", name)
+	}
+	msg := reflect.New(t.Elem()).Interface().(proto.Message)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return name, nil, badRequest("failed to unmarshal %v: %v", name, err)
+	}
+	return name, msg, nil
+}
+
+// handleMessage applies a message sent by a server process to the fleet state.
+func (f *Fleet) handleMessage(processID string, msg proto.Message) (proto.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.processes[processID]
+	if !ok {
+		return nil, badRequest("process %v is not connected", processID)
+	}
+	switch m := msg.(type) {
+	case *pbuffer.ProcessReady:
+		p.Ready = true
+		p.Port = m.GetPort()
+		p.LogPathsToUpload = m.GetLogPathsToUpload()
+	case *pbuffer.ProcessEnding:
+		p.Ending = true
+		p.Ready = false
+	case *pbuffer.ReportHealth:
+		p.Healthy = m.GetHealthStatus()
+		p.LastHealthCheck = f.now()
+	case *pbuffer.GameSessionActivate:
+		g, err := f.processGameSession(p, m.GetGameSessionId())
+		if err != nil {
+			return nil, err
+		}
+		g.Status = GameSessionActive
+	case *pbuffer.GameSessionTerminate:
+		if _, err := f.processGameSession(p, m.GetGameSessionId()); err != nil {
+			return nil, err
+		}
+		f.terminateGameSession(m.GetGameSessionId())
+	case *pbuffer.UpdatePlayerSessionCreationPolicy:
+		g, err := f.processGameSession(p, m.GetGameSessionId())
+		if err != nil {
+			return nil, err
+		}
+		g.PlayerSessionCreationPolicy = m.GetNewPlayerSessionCreationPolicy()
+	case *pbuffer.AcceptPlayerSession:
+		if _, err := f.processGameSession(p, m.GetGameSessionId()); err != nil {
+			return nil, err
+		}
+		return nil, f.acceptPlayerSession(m.GetGameSessionId(), m.GetPlayerSessionId())
+	case *pbuffer.RemovePlayerSession:
+		if _, err := f.processGameSession(p, m.GetGameSessionId()); err != nil {
+			return nil, err
+		}
+		return nil, f.removePlayerSession(m.GetGameSessionId(), m.GetPlayerSessionId())
+	case *pbuffer.DescribePlayerSessionsRequest:
+		return f.describePlayerSessions(m)
+	case *pbuffer.BackfillMatchmakingRequest:
+		ticketID := m.GetTicketId()
+		if ticketID == "" {
+			ticketID = xid.New().String()
+		}
+		return &pbuffer.BackfillMatchmakingResponse{TicketId: ticketID}, nil
+	case *pbuffer.GetInstanceCertificate:
+		return &pbuffer.GetInstanceCertificateResponse{HostName: f.DNSName}, nil
+	}
+	return nil, nil
+}
+
+func (f *Fleet) processGameSession(p *Process, id string) (*GameSession, error) {
+	g, ok := f.gameSessions[id]
+	if !ok || g.ProcessID != p.ID {
+		return nil, badRequest("game session %v is not placed on process %v", id, p.ID)
+	}
+	return g, nil
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &gamelift.GenericError{GameLiftResponse: pbuffer.GameLiftResponse{
+		Status:       pbuffer.GameLiftResponse_ERROR_400,
+		ErrorMessage: fmt.Sprintf(format, args...),
+	}}
+}
+
+func errorResponse(err error) string {
+	var ge *gamelift.GenericError
+	if !errors.As(err, &ge) {
+		ge = &gamelift.GenericError{GameLiftResponse: pbuffer.GameLiftResponse{
+			Status:       pbuffer.GameLiftResponse_ERROR_500,
+			ErrorMessage: err.Error(),
+		}}
+	}
+	s, err := (&jsonpb.Marshaler{}).MarshalToString(&ge.GameLiftResponse)
+	if err != nil {
+		return "{}"
+	}
+	return s
+}
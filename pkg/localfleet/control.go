@@ -0,0 +1,290 @@
+package localfleet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+// TerminateProcessInput is the body of the terminate request of the control API.
+type TerminateProcessInput struct {
+	// TerminationTime is in unix seconds. Zero means five minutes from now.
+	TerminationTime int64 `json:"terminationTime,omitempty"`
+}
+
+// SetPlayerSessionStatusInput is the body of the player session update request of the control API.
+type SetPlayerSessionStatusInput struct {
+	Status string `json:"status"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// Control returns the HTTP/JSON control API of the fleet.
+//
+//	GET  /processes
+//	GET  /processes/{id}
+//	POST /processes/{id}/terminate          TerminateProcessInput
+//	GET  /game-sessions
+//	POST /game-sessions                     CreateGameSessionInput
+//	GET  /game-sessions/{id}
+//	PUT  /game-sessions/{id}                UpdateGameSessionInput
+//	GET  /player-sessions?gameSessionId=&playerId=&playerSessionId=&status=
+//	POST /player-sessions                   CreatePlayerSessionsInput
+//	PUT  /player-sessions/{id}              SetPlayerSessionStatusInput
+//	GET  /faults
+//	PUT  /faults                            []FaultRule
+//
+// Game session IDs are ARNs and contain slashes; they are used in paths as is.
+func (f *Fleet) Control() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/processes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, f.Processes(), nil)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/processes/{id}", func(w http.ResponseWriter, r *http.Request) {
+		p, err := f.Process(mux.Vars(r)["id"])
+		writeJSON(w, p, err)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/processes/{id}/terminate", func(w http.ResponseWriter, r *http.Request) {
+		var in TerminateProcessInput
+		if !readJSON(w, r, &in) {
+			return
+		}
+		var t time.Time
+		if in.TerminationTime != 0 {
+			t = time.Unix(in.TerminationTime, 0)
+		}
+		p, err := f.TerminateProcess(mux.Vars(r)["id"], t)
+		writeJSON(w, p, err)
+	}).Methods(http.MethodPost)
+
+	r.HandleFunc("/game-sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, f.GameSessions(), nil)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/game-sessions", func(w http.ResponseWriter, r *http.Request) {
+		var in CreateGameSessionInput
+		if !readJSON(w, r, &in) {
+			return
+		}
+		g, err := f.CreateGameSession(&in)
+		writeJSON(w, g, err)
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/game-sessions/{id:.+}", func(w http.ResponseWriter, r *http.Request) {
+		g, err := f.GameSession(mux.Vars(r)["id"])
+		writeJSON(w, g, err)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/game-sessions/{id:.+}", func(w http.ResponseWriter, r *http.Request) {
+		var in UpdateGameSessionInput
+		if !readJSON(w, r, &in) {
+			return
+		}
+		g, err := f.UpdateGameSession(mux.Vars(r)["id"], &in)
+		writeJSON(w, g, err)
+	}).Methods(http.MethodPut)
+
+	r.HandleFunc("/player-sessions", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		writeJSON(w, f.PlayerSessions(&PlayerSessionFilter{
+			GameSessionID:   q.Get("gameSessionId"),
+			PlayerID:        q.Get("playerId"),
+			PlayerSessionID: q.Get("playerSessionId"),
+			Status:          q.Get("status"),
+		}), nil)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/player-sessions", func(w http.ResponseWriter, r *http.Request) {
+		var in CreatePlayerSessionsInput
+		if !readJSON(w, r, &in) {
+			return
+		}
+		ps, err := f.CreatePlayerSessions(&in)
+		writeJSON(w, ps, err)
+	}).Methods(http.MethodPost)
+	r.HandleFunc("/player-sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var in SetPlayerSessionStatusInput
+		if !readJSON(w, r, &in) {
+			return
+		}
+		ps, err := f.SetPlayerSessionStatus(mux.Vars(r)["id"], in.Status)
+		writeJSON(w, ps, err)
+	}).Methods(http.MethodPut)
+
+	r.HandleFunc("/faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, f.Faults(), nil)
+	}).Methods(http.MethodGet)
+	r.HandleFunc("/faults", func(w http.ResponseWriter, r *http.Request) {
+		var rules []FaultRule
+		if !readJSON(w, r, &rules) {
+			return
+		}
+		if err := f.SetFaults(rules); err != nil {
+			writeJSON(w, nil, err)
+			return
+		}
+		writeJSON(w, f.Faults(), nil)
+	}).Methods(http.MethodPut)
+	return r
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		writeJSON(w, nil, fmt.Errorf("%w: %v", ErrorInvalidRequest, err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(statusCode(err))
+		v = errorBody{Error: err.Error()}
+	}
+	json.NewEncoder(w).Encode(v)
+}
+
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrorNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrorInvalidStatus), errors.Is(err, ErrorInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrorNoAvailableProcess), errors.Is(err, ErrorProcessNotReady), errors.Is(err, ErrorProcessBusy),
+		errors.Is(err, ErrorGameSessionFull), errors.Is(err, ErrorPlayerSessionDenied):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// ControlClient calls the control API of a fleet.
+type ControlClient struct {
+	// BaseURL is the URL the control API is served at, e.g. http://127.0.0.1:5758.
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func NewControlClient(baseURL string) *ControlClient {
+	return &ControlClient{BaseURL: baseURL, HTTPClient: http.DefaultClient}
+}
+
+// ControlError is an error returned by the control API.
+type ControlError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *ControlError) Error() string {
+	return fmt.Sprintf("%v: %v", err.StatusCode, err.Message)
+}
+
+func (c *ControlClient) do(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			e.Error = resp.Status
+		}
+		return &ControlError{StatusCode: resp.StatusCode, Message: e.Error}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *ControlClient) Processes() ([]Process, error) {
+	var ps []Process
+	return ps, c.do(http.MethodGet, "/processes", nil, &ps)
+}
+
+func (c *ControlClient) TerminateProcess(id string, terminationTime time.Time) (*Process, error) {
+	in := &TerminateProcessInput{}
+	if !terminationTime.IsZero() {
+		in.TerminationTime = terminationTime.Unix()
+	}
+	p := &Process{}
+	return p, c.do(http.MethodPost, "/processes/"+url.PathEscape(id)+"/terminate", in, p)
+}
+
+func (c *ControlClient) GameSessions() ([]GameSession, error) {
+	var gs []GameSession
+	return gs, c.do(http.MethodGet, "/game-sessions", nil, &gs)
+}
+
+func (c *ControlClient) GameSession(id string) (*GameSession, error) {
+	g := &GameSession{}
+	return g, c.do(http.MethodGet, "/game-sessions/"+id, nil, g)
+}
+
+func (c *ControlClient) CreateGameSession(in *CreateGameSessionInput) (*GameSession, error) {
+	g := &GameSession{}
+	return g, c.do(http.MethodPost, "/game-sessions", in, g)
+}
+
+func (c *ControlClient) UpdateGameSession(id string, in *UpdateGameSessionInput) (*GameSession, error) {
+	g := &GameSession{}
+	return g, c.do(http.MethodPut, "/game-sessions/"+id, in, g)
+}
+
+func (c *ControlClient) PlayerSessions(filter *PlayerSessionFilter) ([]*pbuffer.PlayerSession, error) {
+	q := url.Values{}
+	for k, v := range map[string]string{
+		"gameSessionId":   filter.GameSessionID,
+		"playerId":        filter.PlayerID,
+		"playerSessionId": filter.PlayerSessionID,
+		"status":          filter.Status,
+	} {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	var ps []*pbuffer.PlayerSession
+	return ps, c.do(http.MethodGet, "/player-sessions?"+q.Encode(), nil, &ps)
+}
+
+func (c *ControlClient) CreatePlayerSessions(in *CreatePlayerSessionsInput) ([]*pbuffer.PlayerSession, error) {
+	var ps []*pbuffer.PlayerSession
+	return ps, c.do(http.MethodPost, "/player-sessions", in, &ps)
+}
+
+func (c *ControlClient) SetPlayerSessionStatus(id string, status string) (*pbuffer.PlayerSession, error) {
+	ps := &pbuffer.PlayerSession{}
+	return ps, c.do(http.MethodPut, "/player-sessions/"+url.PathEscape(id), &SetPlayerSessionStatusInput{Status: status}, ps)
+}
+
+func (c *ControlClient) Faults() ([]FaultRule, error) {
+	var rules []FaultRule
+	return rules, c.do(http.MethodGet, "/faults", nil, &rules)
+}
+
+func (c *ControlClient) SetFaults(rules []FaultRule) ([]FaultRule, error) {
+	if rules == nil {
+		rules = []FaultRule{}
+	}
+	var result []FaultRule
+	return result, c.do(http.MethodPut, "/faults", rules, &result)
+}
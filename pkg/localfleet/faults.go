@@ -0,0 +1,162 @@
+package localfleet
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultAction is what a fault rule does to a message.
+type FaultAction string
+
+const (
+	// FaultDelay delays the ack of an incoming message, or the delivery of a pushed event, by DelayMs.
+	FaultDelay FaultAction = "delay"
+	// FaultDrop drops the ack of an incoming message, or the pushed event itself.
+	FaultDrop FaultAction = "drop"
+	// FaultError400 answers an incoming message with an ERROR_400 GameLiftResponse without applying it.
+	FaultError400 FaultAction = "error400"
+	// FaultError500 answers an incoming message with an ERROR_500 GameLiftResponse without applying it.
+	FaultError500 FaultAction = "error500"
+	// FaultClose closes the websocket abruptly, without a close frame.
+	FaultClose FaultAction = "close"
+	// FaultMalformed sends a truncated frame instead of the ack or the pushed event.
+	FaultMalformed FaultAction = "malformed"
+	// FaultDuplicate sends the ack or the pushed event twice.
+	FaultDuplicate FaultAction = "duplicate"
+)
+
+// FaultRule injects a fault into messages between the fleet and its processes.
+// Incoming messages without an ack, such as ReportHealth, are only matched by the rules of
+// FaultError400, FaultError500 and FaultClose, so that the other rules are not used up on them.
+type FaultRule struct {
+	// Message is the name of the message, either the short name such as "AcceptPlayerSession" and "StartGameSession",
+	// or the full protobuf name. An empty Message or "*" matches every message.
+	Message string      `json:"message,omitempty"`
+	Action  FaultAction `json:"action"`
+	// Probability is the chance the rule fires on a matching message. Zero is treated as one.
+	Probability float64 `json:"probability,omitempty"`
+	// DelayMs is the delay of FaultDelay in milliseconds.
+	DelayMs int64 `json:"delayMs,omitempty"`
+	// ErrorMessage is the message of FaultError400 and FaultError500.
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// Count is how many more times the rule fires. Zero means unlimited.
+	Count int `json:"count,omitempty"`
+}
+
+func (r *FaultRule) validate() error {
+	switch r.Action {
+	case FaultDelay, FaultDrop, FaultError400, FaultError500, FaultClose, FaultMalformed, FaultDuplicate:
+	default:
+		return fmt.Errorf("%w: unknown fault action %q", ErrorInvalidRequest, r.Action)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("%w: probability should be between 0 and 1", ErrorInvalidRequest)
+	}
+	if r.Count < 0 || r.DelayMs < 0 {
+		return fmt.Errorf("%w: count and delayMs should not be negative", ErrorInvalidRequest)
+	}
+	return nil
+}
+
+// onAck reports whether the action applies to the ack of an incoming message, rather than the message itself.
+func (a FaultAction) onAck() bool {
+	switch a {
+	case FaultDelay, FaultDrop, FaultMalformed, FaultDuplicate:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *FaultRule) match(name string) bool {
+	if r.Message == "" || r.Message == "*" || r.Message == name {
+		return true
+	}
+	return r.Message == shortName(name)
+}
+
+func (r *FaultRule) delay() time.Duration {
+	return time.Millisecond * time.Duration(r.DelayMs)
+}
+
+// shortName strips the protobuf package from a message name.
+func shortName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+type faultInjector struct {
+	mu    sync.Mutex
+	rules []FaultRule
+	rand  *rand.Rand
+}
+
+func newFaultInjector(seed int64) *faultInjector {
+	return &faultInjector{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (fi *faultInjector) set(rules []FaultRule) error {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rules = append([]FaultRule(nil), rules...)
+	return nil
+}
+
+func (fi *faultInjector) get() []FaultRule {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return append([]FaultRule(nil), fi.rules...)
+}
+
+func (fi *faultInjector) seed(seed int64) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.rand = rand.New(rand.NewSource(seed))
+}
+
+// pick returns the first rule matching name that fires, or nil. acked reports whether the message
+// has an ack, or is pushed to a process; otherwise the rules acting on the ack are skipped.
+func (fi *faultInjector) pick(name string, acked bool) *FaultRule {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	for i := range fi.rules {
+		r := &fi.rules[i]
+		if !r.match(name) || (!acked && r.Action.onAck()) {
+			continue
+		}
+		if r.Probability != 0 && fi.rand.Float64() >= r.Probability {
+			continue
+		}
+		fired := *r
+		if r.Count > 0 {
+			r.Count--
+			if r.Count == 0 {
+				fi.rules = append(fi.rules[:i], fi.rules[i+1:]...)
+			}
+		}
+		return &fired
+	}
+	return nil
+}
+
+// SetFaults replaces the fault rules. Rules are tried in order and the first one firing is applied.
+func (f *Fleet) SetFaults(rules []FaultRule) error {
+	return f.faults.set(rules)
+}
+
+// Faults returns the current fault rules.
+func (f *Fleet) Faults() []FaultRule {
+	return f.faults.get()
+}
+
+// SeedFaults seeds the random source deciding whether probabilistic rules fire.
+func (f *Fleet) SeedFaults(seed int64) {
+	f.faults.seed(seed)
+}
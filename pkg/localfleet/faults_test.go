@@ -0,0 +1,83 @@
+package localfleet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+func TestFaults(t *testing.T) {
+	f, cc, u, stop := startFleet(t)
+	defer stop()
+	f.SeedFaults(1)
+
+	if _, err := cc.SetFaults([]FaultRule{{Action: "explode"}}); err == nil {
+		t.Error("unknown action should be rejected")
+	}
+	if _, err := cc.SetFaults([]FaultRule{
+		{Message: "ProcessReady", Action: FaultError500, ErrorMessage: "boom", Count: 1},
+		{Message: "DescribePlayerSessionsRequest", Action: FaultDelay, DelayMs: 200},
+		{Message: "com.amazon.whitewater.auxproxy.pbuffer.StopMatchmakingRequest", Action: FaultError400, Probability: 0.5},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := gamelift.NewClient(f.logger, gamelift.WithURL(u))
+	c.Handle(newTestHandler())
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ProcessReady(&pbuffer.ProcessReady{Port: 7777})
+	ge, ok := err.(*gamelift.GenericError)
+	if !ok || ge.GetStatus() != pbuffer.GameLiftResponse_ERROR_500 || ge.GetErrorMessage() != "boom" {
+		t.Fatal("ProcessReady should fail with the injected error", err)
+	}
+	if ps := f.Processes(); ps[0].Ready {
+		t.Error("failed ProcessReady should not be applied")
+	}
+	if err := c.ProcessReady(&pbuffer.ProcessReady{Port: 7777}); err != nil {
+		t.Fatal("the fault should fire only once", err)
+	}
+	if rules, _ := cc.Faults(); len(rules) != 2 {
+		t.Error("exhausted rule should be removed", rules)
+	}
+
+	start := time.Now()
+	if _, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{PlayerId: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*200 {
+		t.Error("ack should be delayed", elapsed)
+	}
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if err := c.StopMatchBackfill(&pbuffer.StopMatchmakingRequest{}); err != nil {
+			failed++
+		}
+	}
+	if failed == 0 || failed == 20 {
+		t.Error("probabilistic fault should fire sometimes", failed)
+	}
+}
+
+func TestFaultsWithoutAck(t *testing.T) {
+	fi := newFaultInjector(1)
+	if err := fi.set([]FaultRule{{Action: FaultDrop, Count: 1}, {Message: "ReportHealth", Action: FaultError500, Count: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if r := fi.pick("ReportHealth", false); r == nil || r.Action != FaultError500 {
+		t.Error("only the rules acting on the message itself should match a message without an ack", r)
+	}
+	if r := fi.pick("ReportHealth", false); r != nil {
+		t.Error("rule mismatch", r)
+	}
+	if r := fi.pick("AcceptPlayerSession", true); r == nil || r.Action != FaultDrop {
+		t.Error("the drop rule should not be used up by messages without an ack", r)
+	}
+	if rules := fi.get(); len(rules) != 0 {
+		t.Error("exhausted rules should be removed", rules)
+	}
+}
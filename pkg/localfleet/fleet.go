@@ -0,0 +1,488 @@
+// Package localfleet is a local, test-only stand-in for the GameLift service side.
+// Server processes connect to it instead of the real auxproxy,
+// and game sessions are driven through its control API.
+package localfleet
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+
+	"github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+const (
+	defaultFleetID   = "fleet-local"
+	defaultIPAddress = "127.0.0.1"
+	defaultDNSName   = "localhost"
+	ackTimeout       = time.Second * 10
+	terminateTimeout = time.Minute * 5
+	// reservationTimeout is how long GameLift keeps a player session RESERVED before timing it out.
+	reservationTimeout = time.Second * 60
+)
+
+// Game session statuses.
+const (
+	GameSessionActivating = "ACTIVATING"
+	GameSessionActive     = "ACTIVE"
+	GameSessionTerminated = "TERMINATED"
+)
+
+// Player session statuses.
+const (
+	PlayerSessionReserved  = "RESERVED"
+	PlayerSessionActive    = "ACTIVE"
+	PlayerSessionCompleted = "COMPLETED"
+	PlayerSessionTimedOut  = "TIMEDOUT"
+)
+
+var (
+	ErrorNotFound            = errors.New("not found")
+	ErrorNoAvailableProcess  = errors.New("no available process")
+	ErrorProcessNotReady     = errors.New("process is not ready")
+	ErrorProcessBusy         = errors.New("process already hosts a game session")
+	ErrorInvalidStatus       = errors.New("invalid status")
+	ErrorInvalidRequest      = errors.New("invalid request")
+	ErrorGameSessionFull     = errors.New("game session is full")
+	ErrorPlayerSessionDenied = errors.New("game session does not accept new player sessions")
+	ErrorGameSessionNotFound = fmt.Errorf("game session %w", ErrorNotFound)
+)
+
+// Process is a server process connected to the fleet.
+type Process struct {
+	ID               string    `json:"id"`
+	PID              string    `json:"pid"`
+	SDKVersion       string    `json:"sdkVersion"`
+	Connected        bool      `json:"connected"`
+	Ready            bool      `json:"ready"`
+	Ending           bool      `json:"ending"`
+	Port             int32     `json:"port"`
+	LogPathsToUpload []string  `json:"logPathsToUpload,omitempty"`
+	Healthy          bool      `json:"healthy"`
+	LastHealthCheck  time.Time `json:"lastHealthCheck,omitempty"`
+	GameSessionID    string    `json:"gameSessionId,omitempty"`
+	TerminationTime  int64     `json:"terminationTime,omitempty"`
+
+	conn *conn
+}
+
+// GameSession is a game session placed on a process.
+type GameSession struct {
+	pbuffer.GameSession
+	Status                      string    `json:"status"`
+	ProcessID                   string    `json:"processId"`
+	PlayerSessionCreationPolicy string    `json:"playerSessionCreationPolicy"`
+	CreationTime                time.Time `json:"creationTime"`
+}
+
+// CreateGameSessionInput is the input of Fleet.CreateGameSession.
+type CreateGameSessionInput struct {
+	// ProcessID selects the process. An empty ProcessID picks any ready process without a game session.
+	ProcessID       string                  `json:"processId,omitempty"`
+	Name            string                  `json:"name,omitempty"`
+	MaxPlayers      int32                   `json:"maxPlayers,omitempty"`
+	GameProperties  []*pbuffer.GameProperty `json:"gameProperties,omitempty"`
+	GameSessionData string                  `json:"gameSessionData,omitempty"`
+	MatchmakerData  string                  `json:"matchmakerData,omitempty"`
+}
+
+// UpdateGameSessionInput is the input of Fleet.UpdateGameSession.
+// Zero values leave the field unchanged.
+type UpdateGameSessionInput struct {
+	Name             string                  `json:"name,omitempty"`
+	MaxPlayers       int32                   `json:"maxPlayers,omitempty"`
+	GameProperties   []*pbuffer.GameProperty `json:"gameProperties,omitempty"`
+	MatchmakerData   string                  `json:"matchmakerData,omitempty"`
+	UpdateReason     string                  `json:"updateReason,omitempty"`
+	BackfillTicketID string                  `json:"backfillTicketId,omitempty"`
+}
+
+// CreatePlayerSessionsInput is the input of Fleet.CreatePlayerSessions.
+type CreatePlayerSessionsInput struct {
+	GameSessionID string            `json:"gameSessionId"`
+	PlayerIDs     []string          `json:"playerIds"`
+	PlayerData    map[string]string `json:"playerData,omitempty"`
+}
+
+// PlayerSessionFilter selects player sessions. Empty fields match everything.
+type PlayerSessionFilter struct {
+	GameSessionID   string `json:"gameSessionId,omitempty"`
+	PlayerID        string `json:"playerId,omitempty"`
+	PlayerSessionID string `json:"playerSessionId,omitempty"`
+	Status          string `json:"status,omitempty"`
+}
+
+func (f *PlayerSessionFilter) match(ps *pbuffer.PlayerSession) bool {
+	return (f.GameSessionID == "" || f.GameSessionID == ps.GetGameSessionId()) &&
+		(f.PlayerID == "" || f.PlayerID == ps.GetPlayerId()) &&
+		(f.PlayerSessionID == "" || f.PlayerSessionID == ps.GetPlayerSessionId()) &&
+		(f.Status == "" || f.Status == ps.GetStatus())
+}
+
+// Fleet holds the state of a local fleet.
+type Fleet struct {
+	FleetID   string
+	IPAddress string
+	DNSName   string
+	// ReservationTimeout is how long a player session stays RESERVED before it becomes TIMEDOUT.
+	ReservationTimeout time.Duration
+
+	logger log.Logger
+	now    func() time.Time
+	faults *faultInjector
+
+	mu             sync.Mutex
+	processes      map[string]*Process
+	processOrder   []string
+	gameSessions   map[string]*GameSession
+	gameOrder      []string
+	playerSessions map[string]*pbuffer.PlayerSession
+	playerOrder    []string
+	reservedUntil  map[string]time.Time
+}
+
+func NewFleet(logger log.Logger) *Fleet {
+	return &Fleet{
+		FleetID:            defaultFleetID,
+		IPAddress:          defaultIPAddress,
+		DNSName:            defaultDNSName,
+		ReservationTimeout: reservationTimeout,
+		logger:             logger,
+		now:                time.Now,
+		faults:             newFaultInjector(time.Now().UnixNano()),
+		processes:          make(map[string]*Process),
+		gameSessions:       make(map[string]*GameSession),
+		playerSessions:     make(map[string]*pbuffer.PlayerSession),
+		reservedUntil:      make(map[string]time.Time),
+	}
+}
+
+// Processes returns the processes in connection order.
+func (f *Fleet) Processes() []Process {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ps []Process
+	for _, id := range f.processOrder {
+		ps = append(ps, *f.processes[id])
+	}
+	return ps
+}
+
+// Process returns the process with id.
+func (f *Fleet) Process(id string) (Process, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.processes[id]
+	if !ok {
+		return Process{}, fmt.Errorf("process %v %w", id, ErrorNotFound)
+	}
+	return *p, nil
+}
+
+// GameSessions returns the game sessions in creation order.
+func (f *Fleet) GameSessions() []GameSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var gs []GameSession
+	for _, id := range f.gameOrder {
+		gs = append(gs, *f.gameSessions[id])
+	}
+	return gs
+}
+
+// GameSession returns the game session with id.
+func (f *Fleet) GameSession(id string) (GameSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	g, ok := f.gameSessions[id]
+	if !ok {
+		return GameSession{}, ErrorGameSessionNotFound
+	}
+	return *g, nil
+}
+
+// CreateGameSession places a new game session on a process and pushes StartGameSession to it.
+func (f *Fleet) CreateGameSession(in *CreateGameSessionInput) (GameSession, error) {
+	f.mu.Lock()
+	var p *Process
+	if in.ProcessID != "" {
+		var ok bool
+		if p, ok = f.processes[in.ProcessID]; !ok {
+			f.mu.Unlock()
+			return GameSession{}, fmt.Errorf("process %v %w", in.ProcessID, ErrorNotFound)
+		}
+		if !p.Connected || !p.Ready || p.Ending {
+			f.mu.Unlock()
+			return GameSession{}, ErrorProcessNotReady
+		}
+		if p.GameSessionID != "" {
+			f.mu.Unlock()
+			return GameSession{}, fmt.Errorf("process %v %w", in.ProcessID, ErrorProcessBusy)
+		}
+	} else {
+		for _, id := range f.processOrder {
+			c := f.processes[id]
+			if c.Connected && c.Ready && !c.Ending && c.GameSessionID == "" {
+				p = c
+				break
+			}
+		}
+		if p == nil {
+			f.mu.Unlock()
+			return GameSession{}, ErrorNoAvailableProcess
+		}
+	}
+	id := fmt.Sprintf("arn:aws:gamelift:local::gamesession/%v/gsess-%v", f.FleetID, xid.New())
+	g := &GameSession{
+		GameSession: pbuffer.GameSession{
+			GameSessionId:   id,
+			FleetId:         f.FleetID,
+			Name:            in.Name,
+			MaxPlayers:      in.MaxPlayers,
+			Joinable:        true,
+			GameProperties:  in.GameProperties,
+			IpAddress:       f.IPAddress,
+			Port:            p.Port,
+			GameSessionData: in.GameSessionData,
+			MatchmakerData:  in.MatchmakerData,
+			DnsName:         f.DNSName,
+		},
+		Status:                      GameSessionActivating,
+		ProcessID:                   p.ID,
+		PlayerSessionCreationPolicy: "ACCEPT_ALL",
+		CreationTime:                f.now(),
+	}
+	f.gameSessions[id] = g
+	f.gameOrder = append(f.gameOrder, id)
+	p.GameSessionID = id
+	event := &pbuffer.ActivateGameSession{GameSession: copyGameSession(&g.GameSession)}
+	conn := p.conn
+	result := *g
+	f.mu.Unlock()
+
+	if err := f.push(conn, "StartGameSession", event); err != nil {
+		f.removeGameSession(id)
+		return GameSession{}, err
+	}
+	return result, nil
+}
+
+// removeGameSession forgets a game session whose StartGameSession failed, releasing its process.
+func (f *Fleet) removeGameSession(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	g, ok := f.gameSessions[id]
+	if !ok {
+		return
+	}
+	delete(f.gameSessions, id)
+	for i, gid := range f.gameOrder {
+		if gid == id {
+			f.gameOrder = append(f.gameOrder[:i], f.gameOrder[i+1:]...)
+			break
+		}
+	}
+	if p, ok := f.processes[g.ProcessID]; ok && p.GameSessionID == id {
+		p.GameSessionID = ""
+	}
+}
+
+// UpdateGameSession updates a game session and pushes UpdateGameSession to its process.
+func (f *Fleet) UpdateGameSession(id string, in *UpdateGameSessionInput) (GameSession, error) {
+	f.mu.Lock()
+	g, ok := f.gameSessions[id]
+	if !ok {
+		f.mu.Unlock()
+		return GameSession{}, ErrorGameSessionNotFound
+	}
+	if in.Name != "" {
+		g.Name = in.Name
+	}
+	if in.MaxPlayers != 0 {
+		g.MaxPlayers = in.MaxPlayers
+	}
+	if in.GameProperties != nil {
+		g.GameProperties = in.GameProperties
+	}
+	if in.MatchmakerData != "" {
+		g.MatchmakerData = in.MatchmakerData
+	}
+	event := &pbuffer.UpdateGameSession{
+		GameSession:      copyGameSession(&g.GameSession),
+		UpdateReason:     in.UpdateReason,
+		BackfillTicketId: in.BackfillTicketID,
+	}
+	var conn *conn
+	if p, ok := f.processes[g.ProcessID]; ok && p.Connected {
+		conn = p.conn
+	}
+	result := *g
+	f.mu.Unlock()
+
+	if conn == nil {
+		return GameSession{}, ErrorProcessNotReady
+	}
+	if err := f.push(conn, "UpdateGameSession", event); err != nil {
+		return GameSession{}, err
+	}
+	return result, nil
+}
+
+// CreatePlayerSessions reserves player sessions in a game session.
+// Reserved player sessions time out unless the process accepts them within ReservationTimeout.
+func (f *Fleet) CreatePlayerSessions(in *CreatePlayerSessionsInput) ([]*pbuffer.PlayerSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireReservations()
+	g, ok := f.gameSessions[in.GameSessionID]
+	if !ok {
+		return nil, ErrorGameSessionNotFound
+	}
+	if g.Status != GameSessionActive {
+		return nil, fmt.Errorf("%w: game session is %v", ErrorProcessNotReady, g.Status)
+	}
+	if g.PlayerSessionCreationPolicy == "DENY_ALL" {
+		return nil, ErrorPlayerSessionDenied
+	}
+	if g.MaxPlayers > 0 && f.countPlayers(g.GameSessionId)+len(in.PlayerIDs) > int(g.MaxPlayers) {
+		return nil, ErrorGameSessionFull
+	}
+	var result []*pbuffer.PlayerSession
+	for _, playerID := range in.PlayerIDs {
+		ps := &pbuffer.PlayerSession{
+			PlayerSessionId: fmt.Sprintf("psess-%v", xid.New()),
+			PlayerId:        playerID,
+			GameSessionId:   g.GameSessionId,
+			FleetId:         f.FleetID,
+			IpAddress:       g.IpAddress,
+			Status:          PlayerSessionReserved,
+			CreationTime:    f.now().Unix(),
+			Port:            g.Port,
+			PlayerData:      in.PlayerData[playerID],
+			DnsName:         g.DnsName,
+		}
+		f.playerSessions[ps.PlayerSessionId] = ps
+		f.playerOrder = append(f.playerOrder, ps.PlayerSessionId)
+		f.reservedUntil[ps.PlayerSessionId] = f.now().Add(f.ReservationTimeout)
+		result = append(result, copyPlayerSession(ps))
+	}
+	return result, nil
+}
+
+// PlayerSessions returns player sessions matching filter in creation order.
+func (f *Fleet) PlayerSessions(filter *PlayerSessionFilter) []*pbuffer.PlayerSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireReservations()
+	var result []*pbuffer.PlayerSession
+	for _, id := range f.playerOrder {
+		ps := f.playerSessions[id]
+		if filter.match(ps) {
+			result = append(result, copyPlayerSession(ps))
+		}
+	}
+	return result
+}
+
+// SetPlayerSessionStatus forces the status of a player session.
+func (f *Fleet) SetPlayerSessionStatus(id string, status string) (*pbuffer.PlayerSession, error) {
+	switch status {
+	case PlayerSessionReserved, PlayerSessionActive, PlayerSessionCompleted, PlayerSessionTimedOut:
+	default:
+		return nil, fmt.Errorf("%w %q", ErrorInvalidStatus, status)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireReservations()
+	ps, ok := f.playerSessions[id]
+	if !ok {
+		return nil, fmt.Errorf("player session %v %w", id, ErrorNotFound)
+	}
+	f.setPlayerSessionStatus(ps, status)
+	return copyPlayerSession(ps), nil
+}
+
+// TerminateProcess pushes TerminateProcess to a process.
+// A zero terminationTime means five minutes from now.
+func (f *Fleet) TerminateProcess(id string, terminationTime time.Time) (Process, error) {
+	if terminationTime.IsZero() {
+		terminationTime = f.now().Add(terminateTimeout)
+	}
+	f.mu.Lock()
+	p, ok := f.processes[id]
+	if !ok {
+		f.mu.Unlock()
+		return Process{}, fmt.Errorf("process %v %w", id, ErrorNotFound)
+	}
+	if !p.Connected {
+		f.mu.Unlock()
+		return Process{}, ErrorProcessNotReady
+	}
+	p.TerminationTime = terminationTime.Unix()
+	conn := p.conn
+	result := *p
+	f.mu.Unlock()
+
+	if err := f.push(conn, "TerminateProcess", &pbuffer.TerminateProcess{TerminationTime: terminationTime.Unix()}); err != nil {
+		return Process{}, err
+	}
+	return result, nil
+}
+
+func (f *Fleet) connect(id string, pid string, sdkVersion string, c *conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.processes[id] = &Process{
+		ID:         id,
+		PID:        pid,
+		SDKVersion: sdkVersion,
+		Connected:  true,
+		conn:       c,
+	}
+	f.processOrder = append(f.processOrder, id)
+}
+
+func (f *Fleet) disconnect(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.processes[id]
+	if !ok {
+		return
+	}
+	p.Connected = false
+	p.Ready = false
+	p.conn = nil
+	f.terminateGameSession(p.GameSessionID)
+}
+
+func (f *Fleet) terminateGameSession(id string) {
+	g, ok := f.gameSessions[id]
+	if !ok {
+		return
+	}
+	g.Status = GameSessionTerminated
+	for _, psID := range f.playerOrder {
+		ps := f.playerSessions[psID]
+		if ps.GetGameSessionId() == id && (ps.GetStatus() == PlayerSessionReserved || ps.GetStatus() == PlayerSessionActive) {
+			f.setPlayerSessionStatus(ps, PlayerSessionCompleted)
+		}
+	}
+	if p, ok := f.processes[g.ProcessID]; ok && p.GameSessionID == id {
+		p.GameSessionID = ""
+	}
+}
+
+func copyGameSession(g *pbuffer.GameSession) *pbuffer.GameSession {
+	c := *g
+	c.GameProperties = append([]*pbuffer.GameProperty(nil), g.GameProperties...)
+	return &c
+}
+
+func copyPlayerSession(ps *pbuffer.PlayerSession) *pbuffer.PlayerSession {
+	c := *ps
+	return &c
+}
@@ -0,0 +1,207 @@
+package localfleet
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/gamelift"
+	glog "github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+type testHandler struct {
+	c          gamelift.Client
+	started    chan *pbuffer.ActivateGameSession
+	updated    chan *pbuffer.UpdateGameSession
+	terminated chan *pbuffer.TerminateProcess
+}
+
+func newTestHandler() *testHandler {
+	return &testHandler{
+		started:    make(chan *pbuffer.ActivateGameSession, 1),
+		updated:    make(chan *pbuffer.UpdateGameSession, 1),
+		terminated: make(chan *pbuffer.TerminateProcess, 1),
+	}
+}
+
+func (h *testHandler) StartGameSession(event *pbuffer.ActivateGameSession) {
+	if err := h.c.ActivateGameSession(&pbuffer.GameSessionActivate{
+		GameSessionId: event.GetGameSession().GetGameSessionId(),
+	}); err != nil {
+		panic(err)
+	}
+	h.started <- event
+}
+
+func (h *testHandler) UpdateGameSession(event *pbuffer.UpdateGameSession) {
+	h.updated <- event
+}
+
+func (h *testHandler) ProcessTerminate(event *pbuffer.TerminateProcess) {
+	h.terminated <- event
+}
+
+func (h *testHandler) HealthCheck() bool { return true }
+
+func startFleet(t *testing.T) (*Fleet, *ControlClient, string, func()) {
+	logger := &glog.StandardLogger{}
+	f := NewFleet(logger)
+	auxproxy := httptest.NewServer(f.AuxProxy())
+	control := httptest.NewServer(f.Control())
+	u := strings.Replace(auxproxy.URL, "http", "ws", 1) + "/socket.io/"
+	return f, NewControlClient(control.URL), u, func() {
+		control.Close()
+		auxproxy.Close()
+	}
+}
+
+func connect(t *testing.T, u string) (gamelift.Client, *testHandler) {
+	h := newTestHandler()
+	c := gamelift.NewClient(&glog.StandardLogger{}, gamelift.WithURL(u))
+	h.c = c
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ProcessReady(&pbuffer.ProcessReady{Port: 7777}); err != nil {
+		t.Fatal(err)
+	}
+	return c, h
+}
+
+func TestFleet(t *testing.T) {
+	_, cc, u, stop := startFleet(t)
+	defer stop()
+
+	if _, err := cc.CreateGameSession(&CreateGameSessionInput{}); err == nil {
+		t.Fatal("creating a game session without processes should fail")
+	}
+
+	c, h := connect(t, u)
+
+	ps, err := cc.Processes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || !ps[0].Ready || ps[0].Port != 7777 {
+		t.Fatal("unexpected processes", ps)
+	}
+
+	g, err := cc.CreateGameSession(&CreateGameSessionInput{
+		MaxPlayers:      4,
+		GameProperties:  []*pbuffer.GameProperty{{Key: "mode", Value: "ffa"}},
+		GameSessionData: "data",
+		MatchmakerData:  `{"matchId":"m"}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-h.started:
+		gs := event.GetGameSession()
+		if gs.GetGameSessionId() != g.GameSessionId || gs.GetMaxPlayers() != 4 ||
+			gs.GetGameSessionData() != "data" || gs.GetMatchmakerData() != `{"matchId":"m"}` ||
+			gs.GetGameProperties()[0].GetValue() != "ffa" {
+			t.Error("unexpected StartGameSession", event)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("StartGameSession is not delivered")
+	}
+	if id := c.GetGameSessionId(); id == nil || *id != g.GameSessionId {
+		t.Error("game session id mismatch", id)
+	}
+	g2, err := cc.GameSession(g.GameSessionId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g2.Status != GameSessionActive {
+		t.Error("game session should be active", g2.Status)
+	}
+
+	if _, err := cc.UpdateGameSession(g.GameSessionId, &UpdateGameSessionInput{MaxPlayers: 8, UpdateReason: "MATCHMAKING_DATA_UPDATED"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-h.updated:
+		if event.GetGameSession().GetMaxPlayers() != 8 || event.GetUpdateReason() != "MATCHMAKING_DATA_UPDATED" {
+			t.Error("unexpected UpdateGameSession", event)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("UpdateGameSession is not delivered")
+	}
+
+	created, err := cc.CreatePlayerSessions(&CreatePlayerSessionsInput{
+		GameSessionID: g.GameSessionId,
+		PlayerIDs:     []string{"p1", "p2"},
+		PlayerData:    map[string]string{"p1": "d1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created) != 2 || created[0].GetStatus() != PlayerSessionReserved || created[0].GetPlayerData() != "d1" {
+		t.Fatal("unexpected player sessions", created)
+	}
+	if _, err := cc.SetPlayerSessionStatus(created[1].GetPlayerSessionId(), PlayerSessionTimedOut); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := cc.PlayerSessions(&PlayerSessionFilter{GameSessionID: g.GameSessionId, Status: PlayerSessionTimedOut})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 1 || listed[0].GetPlayerId() != "p2" {
+		t.Error("unexpected player sessions", listed)
+	}
+	if _, err := cc.SetPlayerSessionStatus(created[0].GetPlayerSessionId(), "UNKNOWN"); err == nil {
+		t.Error("unknown status should fail")
+	}
+
+	deadline := time.Now().Add(time.Minute).Truncate(time.Second)
+	if _, err := cc.TerminateProcess(ps[0].ID, deadline); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-h.terminated:
+		if event.GetTerminationTime() != deadline.Unix() {
+			t.Error("termination time mismatch", event.GetTerminationTime(), deadline.Unix())
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("TerminateProcess is not delivered")
+	}
+	if tt := c.GetTerminationTime(); tt == nil || !tt.Equal(deadline) {
+		t.Error("termination time mismatch", tt)
+	}
+}
+
+func TestCreateGameSessionOnProcess(t *testing.T) {
+	f, _, u, stop := startFleet(t)
+	defer stop()
+	_, h := connect(t, u)
+	p := f.Processes()[0]
+
+	g, err := f.CreateGameSession(&CreateGameSessionInput{ProcessID: p.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-h.started
+	if _, err := f.CreateGameSession(&CreateGameSessionInput{ProcessID: p.ID}); !errors.Is(err, ErrorProcessBusy) {
+		t.Error("busy process should be rejected", err)
+	}
+	if g2, _ := f.GameSession(g.GameSessionId); g2.ProcessID != p.ID || len(f.GameSessions()) != 1 {
+		t.Error("game session should be kept", g2)
+	}
+
+	_, h = connect(t, u)
+	p = f.Processes()[1]
+	if err := f.SetFaults([]FaultRule{{Message: "StartGameSession", Action: FaultClose, Count: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.CreateGameSession(&CreateGameSessionInput{ProcessID: p.ID}); err == nil {
+		t.Fatal("failed StartGameSession should fail CreateGameSession")
+	}
+	if p, _ := f.Process(p.ID); p.GameSessionID != "" || len(f.GameSessions()) != 1 {
+		t.Error("failed game session should be rolled back", p)
+	}
+}
@@ -0,0 +1,144 @@
+package localfleet
+
+import (
+	"strconv"
+
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+// maxDescribeLimit is the largest page DescribePlayerSessions returns.
+const maxDescribeLimit = 1024
+
+// The functions below must be called with f.mu held.
+
+// expireReservations times out player sessions that stayed RESERVED past their deadline.
+func (f *Fleet) expireReservations() {
+	now := f.now()
+	for id, until := range f.reservedUntil {
+		if now.Before(until) {
+			continue
+		}
+		if ps, ok := f.playerSessions[id]; ok && ps.GetStatus() == PlayerSessionReserved {
+			f.setPlayerSessionStatus(ps, PlayerSessionTimedOut)
+		}
+		delete(f.reservedUntil, id)
+	}
+}
+
+func (f *Fleet) setPlayerSessionStatus(ps *pbuffer.PlayerSession, status string) {
+	ps.Status = status
+	switch status {
+	case PlayerSessionReserved:
+		ps.TerminationTime = 0
+		f.reservedUntil[ps.PlayerSessionId] = f.now().Add(f.ReservationTimeout)
+	case PlayerSessionActive:
+		ps.TerminationTime = 0
+		delete(f.reservedUntil, ps.PlayerSessionId)
+	case PlayerSessionCompleted, PlayerSessionTimedOut:
+		ps.TerminationTime = f.now().Unix()
+		delete(f.reservedUntil, ps.PlayerSessionId)
+	}
+}
+
+// countPlayers counts player sessions holding a slot in a game session.
+func (f *Fleet) countPlayers(gameSessionID string) int {
+	n := 0
+	for _, ps := range f.playerSessions {
+		if ps.GetGameSessionId() == gameSessionID &&
+			(ps.GetStatus() == PlayerSessionReserved || ps.GetStatus() == PlayerSessionActive) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *Fleet) gamePlayerSession(gameSessionID string, playerSessionID string) (*pbuffer.PlayerSession, error) {
+	ps, ok := f.playerSessions[playerSessionID]
+	if !ok || ps.GetGameSessionId() != gameSessionID {
+		return nil, badRequest("player session %v is not found in game session %v", playerSessionID, gameSessionID)
+	}
+	return ps, nil
+}
+
+func (f *Fleet) acceptPlayerSession(gameSessionID string, playerSessionID string) error {
+	f.expireReservations()
+	ps, err := f.gamePlayerSession(gameSessionID, playerSessionID)
+	if err != nil {
+		return err
+	}
+	if ps.GetStatus() != PlayerSessionReserved {
+		return badRequest("player session %v is %v, not %v", playerSessionID, ps.GetStatus(), PlayerSessionReserved)
+	}
+	f.setPlayerSessionStatus(ps, PlayerSessionActive)
+	return nil
+}
+
+func (f *Fleet) removePlayerSession(gameSessionID string, playerSessionID string) error {
+	f.expireReservations()
+	ps, err := f.gamePlayerSession(gameSessionID, playerSessionID)
+	if err != nil {
+		return err
+	}
+	if ps.GetStatus() != PlayerSessionReserved && ps.GetStatus() != PlayerSessionActive {
+		return badRequest("player session %v is already %v", playerSessionID, ps.GetStatus())
+	}
+	f.setPlayerSessionStatus(ps, PlayerSessionCompleted)
+	return nil
+}
+
+// describePlayerSessions answers DescribePlayerSessions.
+// NextToken is the offset of the next page in the filtered result.
+func (f *Fleet) describePlayerSessions(req *pbuffer.DescribePlayerSessionsRequest) (*pbuffer.DescribePlayerSessionsResponse, error) {
+	f.expireReservations()
+	if req.GetGameSessionId() == "" && req.GetPlayerId() == "" && req.GetPlayerSessionId() == "" {
+		return nil, badRequest("one of gameSessionId, playerId or playerSessionId is required")
+	}
+	status := req.GetPlayerSessionStatusFilter()
+	switch status {
+	case "", PlayerSessionReserved, PlayerSessionActive, PlayerSessionCompleted, PlayerSessionTimedOut:
+	default:
+		return nil, badRequest("invalid playerSessionStatusFilter %v", status)
+	}
+	limit := int(req.GetLimit())
+	if limit < 0 || limit > maxDescribeLimit {
+		return nil, badRequest("limit should be between 1 and %v", maxDescribeLimit)
+	}
+	if limit == 0 || req.GetPlayerSessionId() != "" {
+		limit = maxDescribeLimit
+	}
+	offset := 0
+	if req.GetNextToken() != "" {
+		var err error
+		if offset, err = strconv.Atoi(req.GetNextToken()); err != nil || offset < 0 {
+			return nil, badRequest("invalid nextToken %v", req.GetNextToken())
+		}
+	}
+
+	filter := &PlayerSessionFilter{
+		GameSessionID:   req.GetGameSessionId(),
+		PlayerID:        req.GetPlayerId(),
+		PlayerSessionID: req.GetPlayerSessionId(),
+		Status:          status,
+	}
+	var matched []*pbuffer.PlayerSession
+	for _, id := range f.playerOrder {
+		if ps := f.playerSessions[id]; filter.match(ps) {
+			matched = append(matched, ps)
+		}
+	}
+	if offset > len(matched) {
+		return nil, badRequest("invalid nextToken %v", req.GetNextToken())
+	}
+
+	res := &pbuffer.DescribePlayerSessionsResponse{}
+	end := offset + limit
+	if end < len(matched) {
+		res.NextToken = strconv.Itoa(end)
+	} else {
+		end = len(matched)
+	}
+	for _, ps := range matched[offset:end] {
+		res.PlayerSessions = append(res.PlayerSessions, copyPlayerSession(ps))
+	}
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package localfleet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestPlayerSessionLifecycle(t *testing.T) {
+	f, cc, u, stop := startFleet(t)
+	defer stop()
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	f.now = clock.Now
+
+	c, h := connect(t, u)
+	g, err := cc.CreateGameSession(&CreateGameSessionInput{MaxPlayers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-h.started
+
+	created, err := cc.CreatePlayerSessions(&CreatePlayerSessionsInput{
+		GameSessionID: g.GameSessionId,
+		PlayerIDs:     []string{"p1", "p2", "p3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cc.CreatePlayerSessions(&CreatePlayerSessionsInput{
+		GameSessionID: g.GameSessionId,
+		PlayerIDs:     []string{"p4"},
+	}); err == nil {
+		t.Error("creating player sessions beyond maxPlayers should fail")
+	}
+
+	accept := func(ps *pbuffer.PlayerSession) error {
+		return c.AcceptPlayerSession(&pbuffer.AcceptPlayerSession{
+			GameSessionId:   g.GameSessionId,
+			PlayerSessionId: ps.GetPlayerSessionId(),
+		})
+	}
+	if err := accept(created[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := accept(created[0]); err == nil {
+		t.Error("accepting an active player session should fail")
+	}
+	if err := accept(created[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemovePlayerSession(&pbuffer.RemovePlayerSession{
+		GameSessionId:   g.GameSessionId,
+		PlayerSessionId: created[1].GetPlayerSessionId(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// p3 joins late
+	clock.Advance(f.ReservationTimeout)
+	if err := accept(created[2]); err == nil {
+		t.Error("accepting a timed out player session should fail")
+	}
+
+	expect := map[string]string{
+		"p1": PlayerSessionActive,
+		"p2": PlayerSessionCompleted,
+		"p3": PlayerSessionTimedOut,
+	}
+	res, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{GameSessionId: g.GameSessionId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.GetPlayerSessions()) != 3 || res.GetNextToken() != "" {
+		t.Fatal("unexpected response", res)
+	}
+	for _, ps := range res.GetPlayerSessions() {
+		if ps.GetStatus() != expect[ps.GetPlayerId()] {
+			t.Error("status mismatch", ps.GetPlayerId(), ps.GetStatus(), expect[ps.GetPlayerId()])
+		}
+	}
+
+	res, err = c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{
+		GameSessionId:             g.GameSessionId,
+		PlayerSessionStatusFilter: PlayerSessionTimedOut,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.GetPlayerSessions()) != 1 || res.GetPlayerSessions()[0].GetPlayerId() != "p3" {
+		t.Error("unexpected response", res)
+	}
+
+	var pages []string
+	token := ""
+	for {
+		res, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{
+			GameSessionId: g.GameSessionId,
+			Limit:         2,
+			NextToken:     token,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, ps := range res.GetPlayerSessions() {
+			pages = append(pages, ps.GetPlayerId())
+		}
+		if token = res.GetNextToken(); token == "" {
+			break
+		}
+	}
+	if len(pages) != 3 || pages[0] != "p1" || pages[2] != "p3" {
+		t.Error("unexpected pages", pages)
+	}
+
+	if _, err := c.DescribePlayerSessions(&pbuffer.DescribePlayerSessionsRequest{}); err == nil {
+		t.Error("describing without an id should fail")
+	}
+}
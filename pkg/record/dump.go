@@ -0,0 +1,333 @@
+package record
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	// registers the pbuffer messages to decode
+	_ "github.com/neguse/gomelift/pkg/proto/pbuffer"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+const pbufferPackage = "com.amazon.whitewater.auxproxy.pbuffer."
+
+// pushedTypes are the types of the events pushed by the auxproxy, named differently from their messages.
+var pushedTypes = map[string]string{
+	"StartGameSession":  pbufferPackage + "ActivateGameSession",
+	"UpdateGameSession": pbufferPackage + "UpdateGameSession",
+	"TerminateProcess":  pbufferPackage + "TerminateProcess",
+}
+
+// logLine matches a line of a log with a frame, such as "2020/04/01 12:00:00 sending [42[...]]",
+// where the time is the prefix of the standard logger and the brackets are of the arguments logged.
+var logLine = regexp.MustCompile(`^(?:(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) )?.*?\b(sending|recv|received) (.*?)\s*$`)
+
+// ParseLogLine extracts a frame from a line of a log, or of a file written by Recorder.
+// It reports false if the line has no frame.
+//
+// Frames are found after "sending", which are outbound, and "recv" or "received", which are inbound.
+// A socket.io packet logged without the Engine.IO message type, as socketio.Client does, is taken as a message.
+func ParseLogLine(line string) (Frame, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		var f Frame
+		if err := json.Unmarshal([]byte(line), &f); err != nil || f.Raw == "" {
+			return Frame{}, false
+		}
+		return DecodeFrame(f.Time, f.Direction, f.Raw), true
+	}
+	m := logLine.FindStringSubmatch(line)
+	if m == nil {
+		return Frame{}, false
+	}
+	var t time.Time
+	if m[1] != "" {
+		t, _ = time.ParseInLocation("2006/01/02 15:04:05.999999", m[1], time.Local)
+	}
+	dir := eventio.Inbound
+	if m[2] == "sending" {
+		dir = eventio.Outbound
+	}
+	raw := m[3]
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		raw = raw[1 : len(raw)-1]
+	}
+	f := DecodeFrame(t, dir, raw)
+	if f.EngineIO == nil {
+		return Frame{}, false
+	}
+	if f.SocketIO == nil && f.EngineIO.Type != eventio.Message && f.EngineIO.Data != "" && f.EngineIO.Data != "probe" {
+		if g := DecodeFrame(t, dir, "4"+raw); g.SocketIO != nil {
+			return g, true
+		}
+	}
+	return f, true
+}
+
+// Message is a frame decoded for reading.
+type Message struct {
+	Time      *time.Time        `json:"time,omitempty"`
+	Direction eventio.Direction `json:"direction"`
+	// EngineIO is the type of an Engine.IO packet carrying no socket.io packet, such as "Ping".
+	EngineIO  string `json:"engineio,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	ID        *int   `json:"id,omitempty"`
+	Event     string `json:"event,omitempty"`
+	// MessageType is the pbuffer message the payload is decoded as.
+	MessageType string `json:"messageType,omitempty"`
+	// Data is the arguments of the packet, with the payloads decoded into JSON.
+	Data []json.RawMessage `json:"data,omitempty"`
+	// Request is the event an ack replies to, and Elapsed is the time since the request.
+	Request string `json:"request,omitempty"`
+	Elapsed string `json:"elapsed,omitempty"`
+	// Error describes why the frame is not decoded.
+	Error string `json:"error,omitempty"`
+}
+
+type request struct {
+	event string
+	time  time.Time
+}
+
+type requestKey struct {
+	dir       eventio.Direction
+	namespace string
+	id        int
+}
+
+// binaryPacket is a BinaryEvent or BinaryAck waiting for its attachments.
+type binaryPacket struct {
+	frame   Frame
+	buffers [][]byte
+}
+
+// Dumper decodes the frames of a connection into Messages, pairing requests with their acks.
+type Dumper struct {
+	requests map[requestKey]request
+	binary   map[eventio.Direction]*binaryPacket
+}
+
+// NewDumper creates a Dumper.
+func NewDumper() *Dumper {
+	return &Dumper{
+		requests: make(map[requestKey]request),
+		binary:   make(map[eventio.Direction]*binaryPacket),
+	}
+}
+
+// Dump decodes f. It reports false for the attachments of binary packets, which are decoded with the packet.
+func (d *Dumper) Dump(f Frame) (Message, bool) {
+	m := Message{Direction: f.Direction}
+	if !f.Time.IsZero() {
+		t := f.Time
+		m.Time = &t
+	}
+	if f.EngineIO == nil {
+		m.Error = "malformed Engine.IO packet: " + f.Raw
+		return m, true
+	}
+	if f.EngineIO.Type == eventio.Message && f.EngineIO.Binary {
+		return d.attach(f)
+	}
+	if f.SocketIO == nil {
+		m.EngineIO = f.EngineIO.Type.String()
+		if f.EngineIO.Type == eventio.Message {
+			m.Error = "malformed socket.io packet: " + f.EngineIO.Data
+		} else if f.EngineIO.Data != "" {
+			m.Data = []json.RawMessage{jsonString(f.EngineIO.Data)}
+		}
+		return m, true
+	}
+	p := *f.SocketIO
+	if (p.Type == socketio.BinaryEvent || p.Type == socketio.BinaryAck) && p.Attachments > 0 {
+		d.binary[f.Direction] = &binaryPacket{frame: f}
+		return Message{}, false
+	}
+	return d.message(m, p), true
+}
+
+// attach adds a binary frame to the packet waiting for it.
+func (d *Dumper) attach(f Frame) (Message, bool) {
+	b := d.binary[f.Direction]
+	if b == nil {
+		m := Message{Direction: f.Direction, EngineIO: f.EngineIO.Type.String(), Error: "unexpected attachment"}
+		if !f.Time.IsZero() {
+			m.Time = &f.Time
+		}
+		return m, true
+	}
+	b.buffers = append(b.buffers, []byte(f.EngineIO.Data))
+	if len(b.buffers) < b.frame.SocketIO.Attachments {
+		return Message{}, false
+	}
+	delete(d.binary, f.Direction)
+	m := Message{Direction: b.frame.Direction}
+	if !b.frame.Time.IsZero() {
+		m.Time = &b.frame.Time
+	}
+	p, err := socketio.ReconstructPacket(*b.frame.SocketIO, b.buffers)
+	if err != nil {
+		m.Error = err.Error()
+		return m, true
+	}
+	return d.message(m, p), true
+}
+
+func (d *Dumper) message(m Message, p socketio.Packet) Message {
+	m.Type = p.Type.String()
+	m.Namespace = p.Namespace
+	m.ID = p.ID
+	switch p.Type {
+	case socketio.Event, socketio.BinaryEvent:
+		m.Event = socketio.EventName(&p)
+		name := m.Event
+		if t, ok := pushedTypes[name]; ok {
+			name = t
+		}
+		if proto.MessageType(name) != nil {
+			m.MessageType = name
+		}
+		if p.ID != nil {
+			r := request{event: m.Event}
+			if m.Time != nil {
+				r.time = *m.Time
+			}
+			d.requests[requestKey{m.Direction, p.Namespace, *p.ID}] = r
+		}
+		m.Data = decodeArgs(p.Data, m.MessageType, false)
+	case socketio.Ack, socketio.BinaryAck:
+		// the request was sent in the other direction
+		var key requestKey
+		if p.ID != nil {
+			key = requestKey{eventio.Inbound, p.Namespace, *p.ID}
+			if m.Direction == eventio.Inbound {
+				key.dir = eventio.Outbound
+			}
+		}
+		if r, ok := d.requests[key]; ok && p.ID != nil {
+			delete(d.requests, key)
+			m.Request = r.event
+			if m.Time != nil && !r.time.IsZero() {
+				m.Elapsed = m.Time.Sub(r.time).String()
+			}
+			m.MessageType = responseType(r.event)
+		}
+		if len(p.Data) > 1 && string(toRaw(p.Data[0])) == "false" {
+			m.MessageType = pbufferPackage + "GameLiftResponse"
+		}
+		m.Data = decodeArgs(p.Data, m.MessageType, true)
+	default:
+		m.Data = decodeArgs(p.Data, "", false)
+	}
+	return m
+}
+
+// responseType returns the pbuffer message of the ack of the request event, or "" if unknown.
+// The acks of failed requests carry GameLiftResponse instead.
+func responseType(event string) string {
+	name := strings.TrimSuffix(event, "Request") + "Response"
+	if strings.HasPrefix(name, pbufferPackage) && proto.MessageType(name) != nil {
+		return name
+	}
+	return ""
+}
+
+// decodeArgs decodes the payloads in the arguments of a packet as messageType, which may be empty.
+//
+// Requests carry the message in protobuf, which is base64 encoded as []byte in JSON, while events pushed by
+// the auxproxy carry it as a string of JSON, and acks as a string of jsonpb if ack is set.
+func decodeArgs(args []interface{}, messageType string, ack bool) []json.RawMessage {
+	data := make([]json.RawMessage, 0, len(args))
+	for _, arg := range args {
+		raw := toRaw(arg)
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			if decoded, ok := decodePayload(s, messageType, ack); ok {
+				raw = decoded
+			}
+		}
+		data = append(data, raw)
+	}
+	return data
+}
+
+func toRaw(arg interface{}) json.RawMessage {
+	switch v := arg.(type) {
+	case json.RawMessage:
+		return v
+	case []byte:
+		// an attachment
+		raw, _ := json.Marshal(base64.StdEncoding.EncodeToString(v))
+		return raw
+	default:
+		raw, _ := json.Marshal(v)
+		return raw
+	}
+}
+
+func decodePayload(s string, messageType string, ack bool) (json.RawMessage, bool) {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		if msg := newMessage(messageType); msg != nil {
+			var err error
+			if ack {
+				err = jsonpb.UnmarshalString(trimmed, msg)
+			} else {
+				err = json.Unmarshal([]byte(trimmed), msg)
+			}
+			if err == nil {
+				if raw, ok := marshalMessage(msg); ok {
+					return raw, true
+				}
+			}
+		}
+		return json.RawMessage(trimmed), true
+	}
+	if messageType == "" {
+		return nil, false
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	msg := newMessage(messageType)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, false
+	}
+	return marshalMessage(msg)
+}
+
+func newMessage(name string) proto.Message {
+	if name == "" {
+		return nil
+	}
+	t := proto.MessageType(name)
+	if t == nil {
+		return nil
+	}
+	msg, _ := reflect.New(t.Elem()).Interface().(proto.Message)
+	return msg
+}
+
+func marshalMessage(msg proto.Message) (json.RawMessage, bool) {
+	var buf bytes.Buffer
+	if err := (&jsonpb.Marshaler{}).Marshal(&buf, msg); err != nil {
+		return nil, false
+	}
+	return json.RawMessage(buf.Bytes()), true
+}
+
+func jsonString(s string) json.RawMessage {
+	raw, _ := json.Marshal(s)
+	return raw
+}
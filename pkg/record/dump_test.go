@@ -0,0 +1,93 @@
+package record
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+)
+
+func TestParseLogLine(t *testing.T) {
+	cases := []struct {
+		line     string
+		ok       bool
+		dir      eventio.Direction
+		socketio bool
+	}{
+		{`2020/04/01 12:00:00 sending [42["ProcessReady"]]`, true, eventio.Outbound, true},
+		{`2020/04/01 12:00:00.5 recv [431["ok"]]`, true, eventio.Inbound, true},
+		{`2020/04/01 12:00:00 sending [2["ProcessReady"]]`, true, eventio.Outbound, true},
+		{`received 3`, true, eventio.Inbound, false},
+		{`2020/04/01 12:00:00 connected`, false, 0, false},
+		{`{"time":"2020-04-01T12:00:00Z","direction":"Outbound","raw":"42[\"ProcessReady\"]"}`, true, eventio.Outbound, true},
+	}
+	for _, c := range cases {
+		f, ok := ParseLogLine(c.line)
+		if ok != c.ok {
+			t.Error("ok mismatch", c.line, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if f.Direction != c.dir || (f.SocketIO != nil) != c.socketio {
+			t.Error("frame mismatch", c.line, f)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	d := NewDumper()
+	start := time.Now()
+	call := callFrame(t, 1, &pbuffer.DescribePlayerSessionsRequest{GameSessionId: "gs-1"})
+	call.Time = start
+	m, ok := d.Dump(call)
+	if !ok {
+		t.Fatal("call is not dumped")
+	}
+	if m.MessageType != "com.amazon.whitewater.auxproxy.pbuffer.DescribePlayerSessionsRequest" {
+		t.Error("message type mismatch", m.MessageType)
+	}
+	if len(m.Data) != 2 || string(m.Data[1]) != `{"gameSessionId":"gs-1"}` {
+		t.Error("data mismatch", m.Data)
+	}
+
+	ack := DecodeFrame(start.Add(time.Second), eventio.Inbound, `431[true,"{\"playerSessions\":[{\"playerId\":\"p1\"}]}"]`)
+	m, _ = d.Dump(ack)
+	if m.Request != "com.amazon.whitewater.auxproxy.pbuffer.DescribePlayerSessionsRequest" || m.Elapsed != "1s" {
+		t.Error("ack is not paired", m)
+	}
+	if m.MessageType != "com.amazon.whitewater.auxproxy.pbuffer.DescribePlayerSessionsResponse" {
+		t.Error("message type mismatch", m.MessageType)
+	}
+	if len(m.Data) != 2 || string(m.Data[1]) != `{"playerSessions":[{"playerId":"p1"}]}` {
+		t.Error("data mismatch", m.Data)
+	}
+
+	failed := DecodeFrame(start, eventio.Inbound, `431[false,"{\"status\":\"ERROR_400\",\"errorMessage\":\"bad\"}"]`)
+	m, _ = d.Dump(failed)
+	if m.Request != "" || m.MessageType != "com.amazon.whitewater.auxproxy.pbuffer.GameLiftResponse" {
+		t.Error("failed ack mismatch", m)
+	}
+
+	pushed := eventFrame(t, eventio.Inbound, 2, "StartGameSession", `{"gameSession":{"gameSessionId":"gs-1"}}`)
+	m, _ = d.Dump(pushed)
+	if m.MessageType != "com.amazon.whitewater.auxproxy.pbuffer.ActivateGameSession" {
+		t.Error("message type mismatch", m.MessageType)
+	}
+	var event pbuffer.ActivateGameSession
+	if len(m.Data) != 2 || json.Unmarshal(m.Data[1], &event) != nil || event.GetGameSession().GetGameSessionId() != "gs-1" {
+		t.Error("data mismatch", m.Data)
+	}
+
+	m, _ = d.Dump(rawFrame(eventio.Outbound, "2probe"))
+	if m.EngineIO != "Ping" || len(m.Data) != 1 || string(m.Data[0]) != `"probe"` {
+		t.Error("ping mismatch", m)
+	}
+	m, _ = d.Dump(rawFrame(eventio.Inbound, "4x"))
+	if m.Error == "" {
+		t.Error("malformed packet should be reported", m)
+	}
+}
@@ -0,0 +1,103 @@
+package record
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+// Frame is a single Engine.IO frame exchanged between a client and the auxproxy.
+type Frame struct {
+	Time      time.Time         `json:"time"`
+	Direction eventio.Direction `json:"direction"`
+	Raw       string            `json:"raw"`
+	EngineIO  *eventio.Packet   `json:"engineio,omitempty"`
+	SocketIO  *socketio.Packet  `json:"socketio,omitempty"`
+}
+
+// DecodeFrame decodes raw into a Frame. Layers that fail to decode are left nil.
+func DecodeFrame(t time.Time, dir eventio.Direction, raw string) Frame {
+	f := Frame{Time: t, Direction: dir, Raw: raw}
+	ep, err := eventio.ParsePacket(raw)
+	if err != nil {
+		return f
+	}
+	f.EngineIO = &ep
+	if ep.Type != eventio.Message || ep.Binary {
+		return f
+	}
+	sp, err := socketio.DecodePacket(ep.Data)
+	if err != nil {
+		return f
+	}
+	f.SocketIO = &sp
+	return f
+}
+
+// EventName returns the socket.io event name of f, or "" if f is not an event.
+func (f *Frame) EventName() string {
+	if f.SocketIO == nil || f.SocketIO.Type != socketio.Event || len(f.SocketIO.Data) == 0 {
+		return ""
+	}
+	raw, err := json.Marshal(f.SocketIO.Data[0])
+	if err != nil {
+		return ""
+	}
+	var name string
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// Recorder writes frames to w as JSON lines.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+	now func() time.Time
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc: json.NewEncoder(w),
+		now: time.Now,
+	}
+}
+
+// Hook records a frame. It has the signature of eventio.FrameHook.
+func (r *Recorder) Hook(dir eventio.Direction, frame string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(DecodeFrame(r.now(), dir, frame))
+}
+
+// Err returns the first error occurred while writing.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// ReadFrames reads frames written by Recorder.
+func ReadFrames(r io.Reader) ([]Frame, error) {
+	var frames []Frame
+	dec := json.NewDecoder(r)
+	for {
+		var f Frame
+		if err := dec.Decode(&f); err == io.EOF {
+			return frames, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// re-decode to restore json.RawMessage typed data
+		frames = append(frames, DecodeFrame(f.Time, f.Direction, f.Raw))
+	}
+}
@@ -0,0 +1,121 @@
+package record
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/gamelift"
+	glog "github.com/neguse/gomelift/pkg/log"
+	"github.com/neguse/gomelift/pkg/proto/pbuffer"
+	"github.com/neguse/gomelift/pkg/socketio"
+)
+
+type testHandler struct {
+	c       gamelift.Client
+	started chan struct{}
+}
+
+func (h *testHandler) StartGameSession(event *pbuffer.ActivateGameSession) {
+	if err := h.c.ActivateGameSession(&pbuffer.GameSessionActivate{
+		GameSessionId: event.GetGameSession().GetGameSessionId(),
+	}); err != nil {
+		panic(err)
+	}
+	close(h.started)
+}
+
+func (h *testHandler) UpdateGameSession(event *pbuffer.UpdateGameSession) {}
+
+func (h *testHandler) ProcessTerminate(event *pbuffer.TerminateProcess) {}
+
+func (h *testHandler) HealthCheck() bool { return true }
+
+func eventFrame(t *testing.T, dir eventio.Direction, id int, data ...interface{}) Frame {
+	s, err := socketio.EncodePacket(socketio.Packet{Type: socketio.Event, ID: &id, Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return DecodeFrame(time.Now(), dir, "4"+s)
+}
+
+func callFrame(t *testing.T, id int, msg proto.Message) Frame {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eventFrame(t, eventio.Outbound, id, proto.MessageName(msg), data)
+}
+
+func rawFrame(dir eventio.Direction, raw string) Frame {
+	return DecodeFrame(time.Now(), dir, raw)
+}
+
+func TestRecordReplay(t *testing.T) {
+	frames := []Frame{
+		rawFrame(eventio.Inbound, `0{"sid":"test","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`),
+		rawFrame(eventio.Inbound, `40`),
+		callFrame(t, 10001, &pbuffer.ProcessReady{Port: 7777}),
+		rawFrame(eventio.Inbound, `4310001[true]`),
+		eventFrame(t, eventio.Inbound, 1, "StartGameSession", `{"gameSession":{"gameSessionId":"gs-1"}}`),
+		rawFrame(eventio.Outbound, `431[true]`),
+		callFrame(t, 10002, &pbuffer.GameSessionActivate{GameSessionId: "gs-1"}),
+		rawFrame(eventio.Inbound, `4310002[true]`),
+	}
+
+	// round trip through the recording format
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	for _, f := range frames {
+		rec.Hook(f.Direction, f.Raw)
+	}
+	if err := rec.Err(); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadFrames(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(frames) {
+		t.Fatal("frame count mismatch", len(read), len(frames))
+	}
+	if name := read[4].EventName(); name != "StartGameSession" {
+		t.Error("event name mismatch", name)
+	}
+
+	logger := &glog.StandardLogger{}
+	replayer := NewReplayer(read, logger)
+	defer replayer.Close()
+	server := httptest.NewServer(replayer)
+	defer server.Close()
+
+	var out bytes.Buffer
+	outRec := NewRecorder(&out)
+	h := &testHandler{started: make(chan struct{})}
+	c := gamelift.NewClient(logger,
+		gamelift.WithURL(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/"),
+		gamelift.WithFrameHook(outRec.Hook))
+	h.c = c
+	c.Handle(h)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ProcessReady(&pbuffer.ProcessReady{Port: 7777}); err != nil {
+		t.Fatal(err)
+	}
+	if err := replayer.Wait(time.Second * 10); err != nil {
+		t.Fatal(err)
+	}
+	<-h.started
+	if id := c.GetGameSessionId(); id == nil || *id != "gs-1" {
+		t.Error("game session id mismatch", id)
+	}
+	if out.Len() == 0 {
+		t.Error("client frames are not recorded")
+	}
+}
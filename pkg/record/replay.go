@@ -0,0 +1,181 @@
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/log"
+)
+
+var (
+	ErrorReplayTimeout    = errors.New("timed out waiting for replay")
+	ErrorReplayInProgress = errors.New("replay is already in progress")
+)
+
+// MismatchError reports an outbound frame that differs from the recording.
+type MismatchError struct {
+	Index    int
+	Expected string
+	Actual   string
+}
+
+func (err *MismatchError) Error() string {
+	return fmt.Sprintf("frame %d mismatch: expected %q, actual %q", err.Index, err.Expected, err.Actual)
+}
+
+// DefaultIgnore ignores frames that depend on timers rather than on the protocol flow:
+// Engine.IO pings and pongs, and ReportHealth events.
+func DefaultIgnore(f Frame) bool {
+	if f.EngineIO != nil && (f.EngineIO.Type == eventio.Ping || f.EngineIO.Type == eventio.Pong) {
+		return true
+	}
+	return f.EventName() == "com.amazon.whitewater.auxproxy.pbuffer.ReportHealth"
+}
+
+// Replayer is an http.Handler standing in for the auxproxy.
+// It sends the recorded inbound frames to the connected client
+// and checks that the client sends the recorded outbound frames in the same order.
+type Replayer struct {
+	// Ignore reports whether a frame is skipped. Outbound frames from the client are filtered too.
+	Ignore func(f Frame) bool
+	// FrameTimeout is how long to wait for each outbound frame.
+	FrameTimeout time.Duration
+
+	frames   []Frame
+	logger   log.Logger
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	started   bool
+	done      chan struct{}
+	err       error
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewReplayer(frames []Frame, logger log.Logger) *Replayer {
+	return &Replayer{
+		Ignore:       DefaultIgnore,
+		FrameTimeout: time.Second * 10,
+		frames:       frames,
+		logger:       logger,
+		done:         make(chan struct{}),
+		closeCh:      make(chan struct{}),
+	}
+}
+
+func (r *Replayer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	if r.started {
+		r.mu.Unlock()
+		http.Error(w, ErrorReplayInProgress.Error(), http.StatusConflict)
+		return
+	}
+	r.started = true
+	r.mu.Unlock()
+
+	conn, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		r.finish(err)
+		return
+	}
+	defer conn.Close()
+
+	outCh := make(chan string, 100)
+	go func() {
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				close(outCh)
+				return
+			}
+			if typ == websocket.BinaryMessage {
+				p, err := eventio.ParseBinaryFrame(data)
+				if err != nil {
+					continue
+				}
+				s, _ := eventio.EncodeBase64Packet(p)
+				data = []byte(s)
+			} else if typ != websocket.TextMessage {
+				continue
+			}
+			if r.Ignore != nil && r.Ignore(DecodeFrame(time.Now(), eventio.Outbound, string(data))) {
+				continue
+			}
+			outCh <- string(data)
+		}
+	}()
+
+	r.finish(r.replay(conn, outCh))
+
+	// keep the connection open so that the client does not observe a disconnect
+	<-r.closeCh
+}
+
+func (r *Replayer) replay(conn *websocket.Conn, outCh <-chan string) error {
+	for i, f := range r.frames {
+		if r.Ignore != nil && r.Ignore(f) {
+			continue
+		}
+		switch f.Direction {
+		case eventio.Inbound:
+			r.logger.Log("replaying", f.Raw)
+			typ, data := websocket.TextMessage, []byte(f.Raw)
+			if f.EngineIO != nil && f.EngineIO.Binary {
+				typ = websocket.BinaryMessage
+				var err error
+				if data, err = eventio.EncodeBinaryFrame(*f.EngineIO); err != nil {
+					return err
+				}
+			}
+			if err := conn.WriteMessage(typ, data); err != nil {
+				return err
+			}
+		case eventio.Outbound:
+			select {
+			case actual, ok := <-outCh:
+				if !ok {
+					return &MismatchError{Index: i, Expected: f.Raw}
+				}
+				if actual != f.Raw {
+					return &MismatchError{Index: i, Expected: f.Raw, Actual: actual}
+				}
+			case <-time.After(r.FrameTimeout):
+				return &MismatchError{Index: i, Expected: f.Raw}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	close(r.done)
+}
+
+// Wait waits until every recorded frame has been replayed, and returns the first mismatch if any.
+func (r *Replayer) Wait(timeout time.Duration) error {
+	select {
+	case <-r.done:
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return r.err
+	case <-time.After(timeout):
+		return ErrorReplayTimeout
+	}
+}
+
+// Close releases the replayed connection.
+func (r *Replayer) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closeCh)
+	})
+}
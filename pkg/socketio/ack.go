@@ -0,0 +1,229 @@
+package socketio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/log"
+)
+
+var (
+	ErrorAckTimeout   = errors.New("ack timed out")
+	ErrorDisconnected = errors.New("disconnected")
+)
+
+// PendingAck is a request waiting for its ack.
+type PendingAck struct {
+	ID        int
+	Namespace string
+	// Event is the event name of the request, or "" if it has none.
+	Event  string
+	SentAt time.Time
+}
+
+type ackResult struct {
+	data []interface{}
+	err  error
+}
+
+type pendingAck struct {
+	PendingAck
+	ch chan ackResult
+}
+
+// ackTable keeps the requests sent on a connection waiting for their acks.
+type ackTable struct {
+	mu      sync.Mutex
+	reqID   int
+	pending map[int]*pendingAck
+	closed  bool
+	timeout time.Duration
+	// maxInFlight limits len(pending) if positive. slotFreed is signaled when a pending ack is removed.
+	maxInFlight int
+	slotFreed   *sync.Cond
+}
+
+func newAckTable(reqID int) *ackTable {
+	t := &ackTable{reqID: reqID, pending: make(map[int]*pendingAck)}
+	t.slotFreed = sync.NewCond(&t.mu)
+	return t
+}
+
+func (t *ackTable) nextID() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reqID++
+	return t.reqID
+}
+
+func (t *ackTable) setTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeout = d
+}
+
+func (t *ackTable) getTimeout() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timeout
+}
+
+func (t *ackTable) setMaxInFlight(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxInFlight = n
+	t.slotFreed.Broadcast()
+}
+
+func (t *ackTable) list() []PendingAck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var acks []PendingAck
+	for _, pa := range t.pending {
+		acks = append(acks, pa.PendingAck)
+	}
+	sort.Slice(acks, func(i, j int) bool { return acks[i].ID < acks[j].ID })
+	return acks
+}
+
+// add assigns a new ID to p and registers it as waiting for the ack.
+// It blocks while the number of pending requests is at the limit set by setMaxInFlight.
+func (t *ackTable) add(p *Packet) (int, chan ackResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for !t.closed && t.maxInFlight > 0 && len(t.pending) >= t.maxInFlight {
+		t.slotFreed.Wait()
+	}
+	if t.closed {
+		return 0, nil, ErrorDisconnected
+	}
+	t.reqID++
+	id := t.reqID
+	p.ID = &id
+	pa := &pendingAck{
+		PendingAck: PendingAck{ID: id, Namespace: namespaceOf(p), Event: EventName(p), SentAt: time.Now()},
+		ch:         make(chan ackResult, 1),
+	}
+	t.pending[id] = pa
+	return id, pa.ch, nil
+}
+
+func (t *ackTable) remove(id int) *pendingAck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pa := t.pending[id]
+	if pa != nil {
+		delete(t.pending, id)
+		t.slotFreed.Signal()
+	}
+	return pa
+}
+
+// send registers p as waiting for the ack and sends it with send.
+func (t *ackTable) send(p *Packet, send func(Packet) error, logger log.Logger) (int, chan ackResult, error) {
+	reqID, ackCh, err := t.add(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	logger.Log("sending need ack", reqID)
+	if err := send(*p); err != nil {
+		t.remove(reqID)
+		return 0, nil, err
+	}
+	return reqID, ackCh, nil
+}
+
+// resolve passes the ack data to the request id. It reports false if id is not pending.
+func (t *ackTable) resolve(id int, data []interface{}) bool {
+	pa := t.remove(id)
+	if pa == nil {
+		return false
+	}
+	pa.ch <- ackResult{data: data}
+	return true
+}
+
+func (t *ackTable) wait(id int, ch chan ackResult, timeout time.Duration) ([]interface{}, error) {
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	select {
+	case r := <-ch:
+		return r.data, r.err
+	case <-timeoutCh:
+		if t.remove(id) == nil {
+			// resolved just now
+			r := <-ch
+			return r.data, r.err
+		}
+		return nil, fmt.Errorf("%w: id %d", ErrorAckTimeout, id)
+	}
+}
+
+// sendWait sends p and waits for its ack until timeout, forever if timeout is zero.
+func (t *ackTable) sendWait(p Packet, timeout time.Duration, send func(Packet) error, logger log.Logger) ([]interface{}, error) {
+	reqID, ackCh, err := t.send(&p, send, logger)
+	if err != nil {
+		return nil, err
+	}
+	ack, err := t.wait(reqID, ackCh, timeout)
+	if err != nil {
+		return nil, err
+	}
+	logger.Log("received ack", ack)
+	return ack, nil
+}
+
+// close fails all pending acks, and the requests sent later, with the error returned.
+func (t *ackTable) close(err error) error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = make(map[int]*pendingAck)
+	t.closed = true
+	t.slotFreed.Broadcast()
+	t.mu.Unlock()
+	failure := ErrorDisconnected
+	if err != nil {
+		failure = fmt.Errorf("%w: %v", ErrorDisconnected, err)
+	}
+	for _, pa := range pending {
+		pa.ch <- ackResult{err: failure}
+	}
+	return failure
+}
+
+// SetAckTimeout sets the default timeout of SendPacketAck and SendAck. Zero, the default, waits forever.
+func (c *Client) SetAckTimeout(d time.Duration) {
+	c.acks.setTimeout(d)
+}
+
+// Pending returns the requests waiting for their acks in the order of ID.
+func (c *Client) Pending() []PendingAck {
+	return c.acks.list()
+}
+
+// SetMaxInFlight limits the number of requests waiting for their acks. Sending another request
+// blocks until one of them is acked, times out or fails. Zero, the default, means no limit.
+func (c *Client) SetMaxInFlight(n int) {
+	c.acks.setMaxInFlight(n)
+}
+
+// HandleClose fails all pending acks and namespace connections when the Engine.IO connection is closed.
+func (c *Client) HandleClose(err error) {
+	failure := c.acks.close(err)
+	c.nspMu.Lock()
+	var namespaces []*Namespace
+	for _, n := range c.namespaces {
+		namespaces = append(namespaces, n)
+	}
+	c.nspMu.Unlock()
+	for _, n := range namespaces {
+		n.connectResult(failure)
+	}
+}
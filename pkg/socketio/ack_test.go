@@ -0,0 +1,85 @@
+package socketio
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestAckTimeout(t *testing.T) {
+	closeCh := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		go func() {
+			<-closeCh
+			conn.Close()
+		}()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.SendAckTimeout([]interface{}{"slow"}, time.Millisecond*50); !errors.Is(err, ErrorAckTimeout) {
+		t.Error("ack should time out", err)
+	}
+	c.SetAckTimeout(time.Millisecond * 50)
+	if _, err := c.SendAck([]interface{}{"slow"}); !errors.Is(err, ErrorAckTimeout) {
+		t.Error("ack should time out by default", err)
+	}
+	if p := c.Pending(); len(p) != 0 {
+		t.Error("timed out requests should not be pending", p)
+	}
+
+	c.SetAckTimeout(0)
+	done := make(chan error, 2)
+	for _, name := range []string{"a", "b"} {
+		name := name
+		go func() {
+			_, err := c.SendAck([]interface{}{name})
+			done <- err
+		}()
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for len(c.Pending()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	p := c.Pending()
+	if len(p) != 2 || p[0].ID >= p[1].ID || p[0].Namespace != DefaultNamespace || (p[0].Event != "a" && p[0].Event != "b") {
+		t.Fatal("pending mismatch", p)
+	}
+
+	close(closeCh)
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrorDisconnected) {
+				t.Error("pending ack should fail on disconnect", err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("pending ack is not failed")
+		}
+	}
+	if _, err := c.SendAck([]interface{}{"after"}); !errors.Is(err, ErrorDisconnected) {
+		t.Error("ack after disconnect should fail", err)
+	}
+}
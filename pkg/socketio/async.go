@@ -0,0 +1,79 @@
+package socketio
+
+import "github.com/neguse/gomelift/pkg/log"
+
+// Call is a request sent asynchronously by GoPacket.
+type Call struct {
+	// Packet is the request. Its ID is assigned when it is sent.
+	Packet Packet
+	// Ack is the data of the ack when Error is nil.
+	Ack   []interface{}
+	Error error
+	// Done receives the call itself when it completes.
+	Done chan *Call
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+		// the caller should have made Done buffered enough
+	}
+}
+
+// GoPacket sends p without waiting for its ack and returns the Call, which is sent to done when the ack
+// arrives, times out by the timeout set by SetAckTimeout, or fails. If done is nil, a new channel is
+// allocated. done must be buffered, as in net/rpc; a call that cannot be delivered is dropped.
+//
+// GoPacket blocks while the number of requests waiting for their acks is at the limit set by SetMaxInFlight,
+// which lets callers pipeline requests over the connection without unbounded buffering.
+func (c *Client) GoPacket(p Packet, done chan *Call) *Call {
+	return goPacket(c.acks, p, done, c.SendPacket, c.logger)
+}
+
+func goPacket(acks *ackTable, p Packet, done chan *Call, send func(Packet) error, logger log.Logger) *Call {
+	if done == nil {
+		done = make(chan *Call, 1)
+	} else if cap(done) == 0 {
+		panic("socketio: done channel is unbuffered")
+	}
+	call := &Call{Packet: p, Done: done}
+	reqID, ackCh, err := acks.send(&call.Packet, send, logger)
+	if err != nil {
+		call.Error = err
+		call.done()
+		return call
+	}
+	timeout := acks.getTimeout()
+	go func() {
+		call.Ack, call.Error = acks.wait(reqID, ackCh, timeout)
+		call.done()
+	}()
+	return call
+}
+
+// Go emits an event without waiting for its ack. See GoPacket.
+func (c *Client) Go(data []interface{}, done chan *Call) *Call {
+	return c.GoPacket(Packet{Type: Event, Data: data}, done)
+}
+
+// SendAckFunc emits an event without waiting for its ack, and calls fn with the result of the ack
+// in another goroutine. See GoPacket.
+func (c *Client) SendAckFunc(data []interface{}, fn func(ack []interface{}, err error)) {
+	call := c.Go(data, nil)
+	go func() {
+		<-call.Done
+		fn(call.Ack, call.Error)
+	}()
+}
+
+// GoPacket sends p in the namespace without waiting for its ack. See Client.GoPacket.
+func (n *Namespace) GoPacket(p Packet, done chan *Call) *Call {
+	p.Namespace = n.name
+	return n.client.GoPacket(p, done)
+}
+
+// Go emits an event in the namespace without waiting for its ack. See Client.GoPacket.
+func (n *Namespace) Go(data []interface{}, done chan *Call) *Call {
+	return n.GoPacket(Packet{Type: Event, Data: data}, done)
+}
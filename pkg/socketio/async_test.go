@@ -0,0 +1,110 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGo(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		conns <- conn
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			recv <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	c.SetMaxInFlight(2)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	conn := <-conns
+
+	done := make(chan *Call, 3)
+	c.Go([]interface{}{"a"}, done)
+	c.Go([]interface{}{"b"}, done)
+	third := make(chan *Call, 1)
+	go func() {
+		third <- c.Go([]interface{}{"c"}, done)
+	}()
+
+	ack := func(n int) {
+		for i := 0; i < n; i++ {
+			select {
+			case s := <-recv:
+				p, err := DecodePacket(strings.TrimPrefix(s, "4"))
+				if err != nil || p.ID == nil {
+					t.Fatal("unexpected frame", s)
+				}
+				conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`43%d[%q]`, *p.ID, EventName(&p))))
+			case <-time.After(time.Second * 5):
+				t.Fatal("no request from the client")
+			}
+		}
+	}
+	// the third request is sent only after one of the first two is acked
+	time.Sleep(time.Millisecond * 100)
+	if n := len(c.Pending()); n != 2 {
+		t.Error("in-flight requests should be limited", n)
+	}
+	ack(2)
+	ack(1)
+
+	got := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		select {
+		case call := <-done:
+			if call.Error != nil || len(call.Ack) != 1 {
+				t.Fatal("call failed", call.Error)
+			}
+			got[string(call.Ack[0].(json.RawMessage))] = true
+		case <-time.After(time.Second * 5):
+			t.Fatal("call is not done")
+		}
+	}
+	if !got[`"a"`] || !got[`"b"`] || !got[`"c"`] {
+		t.Error("acks mismatch", got)
+	}
+	if call := <-third; call.Packet.ID == nil {
+		t.Error("ID of the call should be assigned")
+	}
+
+	// a call waiting for its ack fails on disconnect, and so does the callback
+	results := make(chan error, 1)
+	c.SendAckFunc([]interface{}{"d"}, func(ack []interface{}, err error) {
+		results <- err
+	})
+	<-recv
+	conn.Close()
+	select {
+	case err := <-results:
+		if !errors.Is(err, ErrorDisconnected) {
+			t.Error("callback should fail on disconnect", err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("callback is not called")
+	}
+}
@@ -0,0 +1,110 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+var ErrorAttachment = errors.New("placeholder refers to a missing attachment")
+
+// placeholder stands for a binary attachment in the data of BinaryEvent and BinaryAck.
+type placeholder struct {
+	Placeholder bool `json:"_placeholder"`
+	Num         int  `json:"num"`
+}
+
+// NewBinaryAckPacket returns a BinaryAck answering p, whose []byte in data are sent as attachments.
+func NewBinaryAckPacket(p *Packet, data []interface{}) Packet {
+	ack := NewAckPacket(p, data)
+	ack.Type = BinaryAck
+	return ack
+}
+
+// DeconstructPacket replaces []byte in the data of p, including those nested in []interface{} and
+// map[string]interface{}, with placeholders, and returns them as the attachments in order.
+func DeconstructPacket(p Packet) (Packet, [][]byte) {
+	var buffers [][]byte
+	var walk func(v interface{}) interface{}
+	walk = func(v interface{}) interface{} {
+		switch v := v.(type) {
+		case []byte:
+			buffers = append(buffers, v)
+			return placeholder{Placeholder: true, Num: len(buffers) - 1}
+		case []interface{}:
+			out := make([]interface{}, len(v))
+			for i, e := range v {
+				out[i] = walk(e)
+			}
+			return out
+		case map[string]interface{}:
+			out := make(map[string]interface{}, len(v))
+			for k, e := range v {
+				out[k] = walk(e)
+			}
+			return out
+		}
+		return v
+	}
+	data := make([]interface{}, len(p.Data))
+	for i, e := range p.Data {
+		data[i] = walk(e)
+	}
+	p.Data = data
+	p.Attachments = len(buffers)
+	return p, buffers
+}
+
+// ReconstructPacket replaces placeholders in the data of p with buffers.
+// A placeholder argument becomes []byte, and an argument containing placeholders is decoded into
+// interface{} with json.Number numbers. Other arguments are left as json.RawMessage.
+func ReconstructPacket(p Packet, buffers [][]byte) (Packet, error) {
+	var walk func(v interface{}) (interface{}, error)
+	walk = func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case []interface{}:
+			for i, e := range v {
+				var err error
+				if v[i], err = walk(e); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]interface{}:
+			if ph, ok := v["_placeholder"].(bool); ok && ph {
+				n, _ := v["num"].(json.Number)
+				num, err := n.Int64()
+				if err != nil || num < 0 || int(num) >= len(buffers) {
+					return nil, ErrorAttachment
+				}
+				return buffers[num], nil
+			}
+			for k, e := range v {
+				var err error
+				if v[k], err = walk(e); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return v, nil
+	}
+	data := make([]interface{}, len(p.Data))
+	for i, e := range p.Data {
+		data[i] = e
+		raw, ok := e.(json.RawMessage)
+		if !ok || !bytes.Contains(raw, []byte(`"_placeholder"`)) {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return p, err
+		}
+		var err error
+		if data[i], err = walk(v); err != nil {
+			return p, err
+		}
+	}
+	p.Data = data
+	return p, nil
+}
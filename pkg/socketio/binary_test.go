@@ -0,0 +1,131 @@
+package socketio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDeconstructPacket(t *testing.T) {
+	p := Packet{Type: BinaryEvent, Data: []interface{}{
+		"name",
+		[]byte{1},
+		map[string]interface{}{"blob": []byte{2}, "n": 3},
+		[]interface{}{"x", []byte{3}},
+	}}
+	dp, buffers := DeconstructPacket(p)
+	if dp.Attachments != 3 || len(buffers) != 3 {
+		t.Fatal("attachments mismatch", dp.Attachments, buffers)
+	}
+	s, err := EncodePacket(dp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodePacket(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp, err := ReconstructPacket(decoded, buffers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rp.Data[0].(json.RawMessage)) != `"name"` {
+		t.Error("argument without attachments should be kept", rp.Data[0])
+	}
+	if !reflect.DeepEqual(rp.Data[1], []byte{1}) {
+		t.Error("attachment mismatch", rp.Data[1])
+	}
+	m := rp.Data[2].(map[string]interface{})
+	if !reflect.DeepEqual(m["blob"], []byte{2}) || m["n"] != json.Number("3") {
+		t.Error("nested attachment mismatch", m)
+	}
+	if l := rp.Data[3].([]interface{}); !reflect.DeepEqual(l[1], []byte{3}) {
+		t.Error("nested attachment mismatch", l)
+	}
+
+	if _, err := ReconstructPacket(decoded, buffers[:1]); err != ErrorAttachment {
+		t.Error("missing attachment should fail", err)
+	}
+}
+
+func TestClientBinary(t *testing.T) {
+	recv := make(chan interface{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`451-7["blob",{"_placeholder":true,"num":0}]`))
+		conn.WriteMessage(websocket.BinaryMessage, []byte{4, 0xde, 0xad})
+		for {
+			typ, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if typ == websocket.BinaryMessage {
+				recv <- data
+				continue
+			}
+			recv <- string(data)
+			if strings.HasPrefix(string(data), "451-10001") {
+				conn.WriteMessage(websocket.TextMessage, []byte(`461-10001[{"_placeholder":true,"num":0}]`))
+				conn.WriteMessage(websocket.BinaryMessage, []byte{4, 0xbe, 0xef})
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	events := make(chan *Packet, 1)
+	c.HandleFunc(func(p *Packet) {
+		events <- p
+		if err := c.SendPacket(NewBinaryAckPacket(p, []interface{}{[]byte{1}})); err != nil {
+			panic(err)
+		}
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p := <-events:
+		if p.Type != BinaryEvent || !reflect.DeepEqual(p.Data[1], []byte{0xde, 0xad}) {
+			t.Error("binary event mismatch", p)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no binary event")
+	}
+
+	ack, err := c.SendBinaryAck([]interface{}{"upload", []byte{2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 1 || !reflect.DeepEqual(ack[0], []byte{0xbe, 0xef}) {
+		t.Error("binary ack mismatch", ack)
+	}
+
+	expect := []interface{}{
+		`461-7[{"_placeholder":true,"num":0}]`,
+		[]byte{4, 1},
+		`451-10001["upload",{"_placeholder":true,"num":0}]`,
+		[]byte{4, 2, 3},
+	}
+	for _, e := range expect {
+		select {
+		case f := <-recv:
+			if !reflect.DeepEqual(f, e) {
+				t.Errorf("frame mismatch: %q, expected %q", f, e)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("no frame from the client")
+		}
+	}
+}
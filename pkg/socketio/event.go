@@ -0,0 +1,175 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/neguse/gomelift/pkg/log"
+)
+
+var (
+	packetType = reflect.TypeOf((*Packet)(nil))
+	bytesType  = reflect.TypeOf([]byte(nil))
+)
+
+// eventHandler is a function registered by On.
+type eventHandler struct {
+	fn reflect.Value
+	// withPacket reports whether the first parameter receives the *Packet.
+	withPacket bool
+}
+
+func newEventHandler(f interface{}) eventHandler {
+	fn := reflect.ValueOf(f)
+	if fn.Kind() != reflect.Func {
+		panic(fmt.Sprintf("socketio: handler should be a function, not %T", f))
+	}
+	if fn.Type().IsVariadic() {
+		panic("socketio: handler should not be variadic")
+	}
+	t := fn.Type()
+	return eventHandler{fn: fn, withPacket: t.NumIn() > 0 && t.In(0) == packetType}
+}
+
+// args decodes the arguments of the event p, which follow its name, into the parameters of h.
+// Missing arguments are zero values and extra ones are ignored.
+func (h eventHandler) args(p *Packet) ([]reflect.Value, error) {
+	t := h.fn.Type()
+	var in []reflect.Value
+	first := 0
+	if h.withPacket {
+		in = append(in, reflect.ValueOf(p))
+		first = 1
+	}
+	for i := first; i < t.NumIn(); i++ {
+		typ := t.In(i)
+		v := reflect.New(typ)
+		if n := i - first + 1; n < len(p.Data) {
+			if err := decodeArg(p.Data[n], v.Interface()); err != nil {
+				return nil, fmt.Errorf("argument %d: %w", n, err)
+			}
+		}
+		in = append(in, v.Elem())
+	}
+	return in, nil
+}
+
+// decodeArg decodes an element of Packet.Data into the pointer v.
+func decodeArg(arg interface{}, v interface{}) error {
+	switch a := arg.(type) {
+	case json.RawMessage:
+		return json.Unmarshal(a, v)
+	case []byte:
+		rv := reflect.ValueOf(v).Elem()
+		if rv.Type() == bytesType || rv.Kind() == reflect.Interface {
+			rv.Set(reflect.ValueOf(a))
+			return nil
+		}
+		return fmt.Errorf("binary attachment cannot be decoded into %v", rv.Type())
+	default:
+		// a reconstructed value containing attachments
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+}
+
+// call calls h with the arguments of p and returns the return values.
+func (h eventHandler) call(p *Packet) ([]interface{}, error) {
+	in, err := h.args(p)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, v := range h.fn.Call(in) {
+		out = append(out, v.Interface())
+	}
+	return out, nil
+}
+
+// router dispatches events to the handlers registered by On, or to the catch-all handler.
+type router struct {
+	mu      sync.Mutex
+	handler Handler
+	events  map[string]eventHandler
+}
+
+func (r *router) on(event string, f interface{}) {
+	h := newEventHandler(f)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		r.events = make(map[string]eventHandler)
+	}
+	r.events[event] = h
+}
+
+func (r *router) off(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.events, event)
+}
+
+func (r *router) handle(h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handler = h
+}
+
+// route calls the handler registered for p, and sends its return values with send if p asks for an ack.
+// Events without handlers go to the catch-all handler, if any.
+func (r *router) route(p *Packet, send func(Packet) error, logger log.Logger) {
+	r.mu.Lock()
+	h, ok := r.events[EventName(p)]
+	catchAll := r.handler
+	r.mu.Unlock()
+	if !ok {
+		if catchAll != nil {
+			catchAll.HandleMessage(p)
+		}
+		return
+	}
+	out, err := h.call(p)
+	if err != nil {
+		logger.Log("failed to decode event", EventName(p), err)
+		return
+	}
+	if p.ID == nil {
+		return
+	}
+	ack := NewAckPacket(p, out)
+	if hasBinary(out) {
+		ack.Type = BinaryAck
+	}
+	if err := send(ack); err != nil {
+		logger.Log("failed to send ack", EventName(p), err)
+	}
+}
+
+// EventName returns the name of the event p, or "" if p has no name.
+func EventName(p *Packet) string {
+	if len(p.Data) == 0 {
+		return ""
+	}
+	switch v := p.Data[0].(type) {
+	case string:
+		return v
+	case json.RawMessage:
+		var name string
+		if err := json.Unmarshal(v, &name); err != nil {
+			return ""
+		}
+		return name
+	}
+	return ""
+}
+
+// hasBinary reports whether data contains []byte, which are sent as attachments.
+func hasBinary(data []interface{}) bool {
+	_, buffers := DeconstructPacket(Packet{Data: data})
+	return len(buffers) > 0
+}
@@ -0,0 +1,103 @@
+package socketio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOn(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`42["greet","bob",{"n":2}]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`421["add",1,2]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`422["id"]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`423["add","x"]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`42["unknown"]`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`451-4["blob",{"_placeholder":true,"num":0}]`))
+		conn.WriteMessage(websocket.BinaryMessage, []byte{4, 7})
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			recv <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	greeted := make(chan string, 1)
+	c.On("greet", func(name string, opt struct {
+		N int `json:"n"`
+	}) {
+		greeted <- strings.Repeat(name, opt.N)
+	})
+	c.On("add", func(a int, b int) int {
+		return a + b
+	})
+	c.On("id", func(p *Packet) int {
+		return *p.ID
+	})
+	c.On("blob", func(b []byte) []byte {
+		return append(b, 8)
+	})
+	unknown := make(chan string, 1)
+	c.HandleFunc(func(p *Packet) {
+		unknown <- EventName(p)
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case s := <-greeted:
+		if s != "bobbob" {
+			t.Error("arguments mismatch", s)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("greet is not handled")
+	}
+	select {
+	case name := <-unknown:
+		if name != "unknown" {
+			t.Error("catch-all mismatch", name)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("unknown is not handled")
+	}
+
+	// the ack of "add" with a bad argument is not sent
+	expect := []string{`431[3]`, `432[2]`, `461-4[{"_placeholder":true,"num":0}]`, "\x04\x07\x08"}
+	for _, e := range expect {
+		select {
+		case s := <-recv:
+			if s != e {
+				t.Errorf("frame mismatch: %q, expected %q", s, e)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("no frame from the client")
+		}
+	}
+}
+
+func TestOnPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("On should panic with a non-function")
+		}
+	}()
+	c := NewClient("ws://127.0.0.1/socket.io/", nopLogger{})
+	c.On("event", "not a function")
+}
@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package socketio
+
+import "testing"
+
+// FuzzDecodePacket checks that DecodePacket does not panic, and that a decoded packet is encoded
+// into the same string after a round trip.
+func FuzzDecodePacket(f *testing.F) {
+	for _, s := range []string{
+		"0", "1/chat,", `0/chat,{"token":"abc"}`, `2["name",1]`, `212["name"]`, `3/chat,5[true]`,
+		`4"error"`, `51-["name",{"_placeholder":true,"num":0}]`, `62-/chat,5[1]`, "40 0", "4123",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		p, err := DecodePacket(s)
+		if err != nil {
+			return
+		}
+		enc, err := EncodePacket(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q, err := DecodePacket(enc)
+		if err != nil {
+			t.Fatalf("%q encoded from %q is not decoded: %v", enc, s, err)
+		}
+		if enc2, _ := EncodePacket(q); enc2 != enc {
+			t.Fatalf("round trip mismatch: %q, expected %q", enc2, enc)
+		}
+	})
+}
@@ -0,0 +1,218 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnectError is the Error packet a server refuses a namespace connection with.
+type ConnectError struct {
+	Namespace string
+	Data      json.RawMessage
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connecting to namespace %v refused: %s", e.Namespace, e.Data)
+}
+
+// Namespace is a namespace multiplexed on the connection of a Client.
+// The default namespace is connected by the server when the client opens.
+type Namespace struct {
+	client *Client
+	name   string
+
+	events router
+
+	mu        sync.Mutex
+	id        string
+	connected bool
+	// connecting is the Connect waiting for the answer of the server, shared by concurrent callers.
+	connecting *connectAttempt
+}
+
+// connectAttempt is a Connect packet sent to the server. done is closed when it is answered with err.
+type connectAttempt struct {
+	done chan struct{}
+	err  error
+}
+
+// Name returns the name of the namespace, e.g. "/chat".
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// On registers f to handle the event named event in the namespace.
+//
+// f is a function whose parameters receive the arguments following the event name, decoded from JSON
+// into the parameter types. Binary attachments are received as []byte. If the first parameter is *Packet,
+// it receives the event itself. If the event asks for an ack, the return values of f are sent back as the
+// ack, as BinaryAck if they contain []byte.
+//
+// On panics if f is not a function or is variadic.
+func (n *Namespace) On(event string, f interface{}) {
+	n.events.on(event, f)
+}
+
+// Off removes the handler of event registered by On.
+func (n *Namespace) Off(event string) {
+	n.events.off(event)
+}
+
+// Handle sets the catch-all handler of events in the namespace without handlers registered by On.
+func (n *Namespace) Handle(h Handler) {
+	n.events.handle(h)
+}
+
+// HandleFunc sets the catch-all handler of events in the namespace.
+func (n *Namespace) HandleFunc(fn func(p *Packet)) {
+	n.Handle(HandlerFunc(fn))
+}
+
+// ID returns the socket ID given by the server in socket.io v3 and later, or "" in socket.io v2.
+func (n *Namespace) ID() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.id
+}
+
+func (n *Namespace) setID(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.id = id
+}
+
+// connectedID returns the socket ID in the Connect packet p answering Connect, if any.
+func connectedID(p *Packet) string {
+	if len(p.Data) == 0 {
+		return ""
+	}
+	raw, ok := p.Data[0].(json.RawMessage)
+	if !ok {
+		return ""
+	}
+	var data struct {
+		SID string `json:"sid"`
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return ""
+	}
+	return data.SID
+}
+
+// Connected reports whether the server accepted the namespace.
+func (n *Namespace) Connected() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.connected
+}
+
+func (n *Namespace) setConnected(connected bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.connected = connected
+}
+
+// connectResult handles the Connect or Error packet answering Connect.
+func (n *Namespace) connectResult(err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.connected = err == nil
+	if n.connecting != nil {
+		n.connecting.err = err
+		close(n.connecting.done)
+		n.connecting = nil
+	}
+}
+
+// cancelConnect fails a, unless it is already answered.
+func (n *Namespace) cancelConnect(a *connectAttempt, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.connecting == a {
+		a.err = err
+		close(a.done)
+		n.connecting = nil
+	}
+}
+
+// Connect joins the namespace and waits for the server to accept it, up to the timeout set by
+// Client.SetAckTimeout. Concurrent calls wait for the same answer.
+// A refusal is returned as *ConnectError. In socket.io v3 and later, the auth payload set by
+// Client.SetAuth is sent, and Data of the refusal is an object like {"message":"Not authorized"}.
+func (n *Namespace) Connect() error {
+	n.mu.Lock()
+	if n.connected {
+		n.mu.Unlock()
+		return nil
+	}
+	a := n.connecting
+	pending := a != nil
+	if !pending {
+		a = &connectAttempt{done: make(chan struct{})}
+		n.connecting = a
+	}
+	n.mu.Unlock()
+	if !pending {
+		p := Packet{Type: Connect, Namespace: n.name}
+		if n.client.v5() && n.client.auth != nil {
+			p.Data = []interface{}{n.client.auth}
+		}
+		if err := n.client.SendPacket(p); err != nil {
+			n.cancelConnect(a, err)
+			return err
+		}
+	}
+	var timeout <-chan time.Time
+	if d := n.client.acks.getTimeout(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-a.done:
+	case <-timeout:
+		n.cancelConnect(a, fmt.Errorf("%w: connecting to namespace %v", ErrorAckTimeout, n.name))
+		<-a.done
+	}
+	return a.err
+}
+
+// Disconnect leaves the namespace. The connection of the client is kept.
+func (n *Namespace) Disconnect() error {
+	n.setConnected(false)
+	return n.client.SendPacket(Packet{Type: Disconnect, Namespace: n.name})
+}
+
+// SendPacket sends p in the namespace.
+func (n *Namespace) SendPacket(p Packet) error {
+	p.Namespace = n.name
+	return n.client.SendPacket(p)
+}
+
+// SendPacketAck sends p in the namespace and waits for its ack.
+func (n *Namespace) SendPacketAck(p Packet) ([]interface{}, error) {
+	p.Namespace = n.name
+	return n.client.SendPacketAck(p)
+}
+
+// Send emits an event in the namespace.
+func (n *Namespace) Send(data []interface{}) error {
+	return n.SendPacket(Packet{Type: Event, Data: data})
+}
+
+// SendAck emits an event in the namespace and waits for its ack.
+func (n *Namespace) SendAck(data []interface{}) ([]interface{}, error) {
+	return n.SendPacketAck(Packet{Type: Event, Data: data})
+}
+
+// SendBinary emits an event in the namespace whose []byte are sent as binary attachments.
+func (n *Namespace) SendBinary(data []interface{}) error {
+	return n.SendPacket(Packet{Type: BinaryEvent, Data: data})
+}
+
+// SendBinaryAck emits an event in the namespace whose []byte are sent as binary attachments, and waits for its ack.
+func (n *Namespace) SendBinaryAck(data []interface{}) ([]interface{}, error) {
+	return n.SendPacketAck(Packet{Type: BinaryEvent, Data: data})
+}
@@ -0,0 +1,517 @@
+package socketio
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+	"github.com/neguse/gomelift/pkg/log"
+)
+
+const (
+	DefaultPingInterval = 25 * time.Second
+	DefaultPingTimeout  = 60 * time.Second
+)
+
+// Reasons passed to the handlers set by Socket.OnDisconnect, as in socket.io.
+const (
+	ReasonClientDisconnect = "client namespace disconnect"
+	ReasonServerDisconnect = "server namespace disconnect"
+	ReasonTransportClose   = eventio.ReasonTransportClose
+	ReasonTransportError   = eventio.ReasonTransportError
+	ReasonPingTimeout      = eventio.ReasonPingTimeout
+	ReasonServerShutdown   = "server shutting down"
+)
+
+// Server is a Socket.IO v2 server compatible with Client and the node socket.io v2 client.
+//
+// Server speaks Engine.IO v3 with the polling and websocket transports, served by eventio.Server.
+type Server struct {
+	// PingInterval and PingTimeout are announced to clients in the open packet. A connection without
+	// a packet for PingInterval+PingTimeout is closed. They should be set before serving.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// Upgrader upgrades requests to websocket connections.
+	Upgrader websocket.Upgrader
+
+	logger     log.Logger
+	engine     *eventio.Server
+	engineOnce sync.Once
+	mu         sync.Mutex
+	namespaces map[string]*ServerNamespace
+	conns      map[string]*serverConn
+}
+
+func NewServer(logger log.Logger) *Server {
+	s := &Server{
+		PingInterval: DefaultPingInterval,
+		PingTimeout:  DefaultPingTimeout,
+		logger:       logger,
+		engine:       eventio.NewServer(logger),
+		namespaces:   make(map[string]*ServerNamespace),
+		conns:        make(map[string]*serverConn),
+	}
+	s.engine.Protocols = []eventio.Protocol{eventio.Protocol3}
+	s.engine.OnConnect(s.connect)
+	s.Of(DefaultNamespace)
+	return s
+}
+
+// Of returns the namespace nsp of the server. Clients can only connect to namespaces returned by Of.
+func (s *Server) Of(nsp string) *ServerNamespace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.namespaces[nsp]
+	if !ok {
+		n = &ServerNamespace{server: s, name: nsp, sockets: make(map[string]*Socket)}
+		s.namespaces[nsp] = n
+	}
+	return n
+}
+
+func (s *Server) namespace(nsp string) *ServerNamespace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.namespaces[nsp]
+}
+
+// OnConnect sets fn to be called with the sockets connecting to the default namespace. See ServerNamespace.OnConnect.
+func (s *Server) OnConnect(fn func(socket *Socket)) {
+	s.Of(DefaultNamespace).OnConnect(fn)
+}
+
+// Close closes all connections. Requests served later are refused.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	var conns []*serverConn
+	for _, c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.close(ReasonServerShutdown)
+	}
+	return s.engine.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.engineOnce.Do(func() {
+		s.engine.PingInterval = s.PingInterval
+		s.engine.PingTimeout = s.PingTimeout
+		s.engine.Upgrader = s.Upgrader
+	})
+	s.engine.ServeHTTP(w, r)
+}
+
+// connect starts a connection on a new Engine.IO session and connects it to the default namespace.
+func (s *Server) connect(sess *eventio.Session) {
+	c := &serverConn{
+		server:  s,
+		sess:    sess,
+		sockets: make(map[string]*Socket),
+	}
+	sess.Handle(c)
+	s.mu.Lock()
+	s.conns[sess.ID()] = c
+	s.mu.Unlock()
+	if err := s.Of(DefaultNamespace).connect(c); err != nil {
+		s.logger.Log("failed to connect default namespace", err)
+		c.close(ReasonTransportError)
+	}
+}
+
+// ServerNamespace is a namespace of a Server.
+type ServerNamespace struct {
+	server *Server
+	name   string
+
+	mu        sync.Mutex
+	onConnect func(socket *Socket)
+	sockets   map[string]*Socket
+}
+
+// Name returns the name of the namespace, e.g. "/chat".
+func (n *ServerNamespace) Name() string {
+	return n.name
+}
+
+// OnConnect sets fn to be called with the sockets connecting to the namespace.
+//
+// fn is called before the events of the socket are read, so handlers registered by fn with Socket.On
+// receive all events. Events are handled on the goroutine reading the connection, so fn and the handlers
+// should not wait for acks from the same client; use Socket.Go or another goroutine instead.
+func (n *ServerNamespace) OnConnect(fn func(socket *Socket)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.onConnect = fn
+}
+
+// Sockets returns the sockets connected to the namespace in the order of ID.
+func (n *ServerNamespace) Sockets() []*Socket {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var sockets []*Socket
+	for _, s := range n.sockets {
+		sockets = append(sockets, s)
+	}
+	sort.Slice(sockets, func(i, j int) bool { return sockets[i].ID() < sockets[j].ID() })
+	return sockets
+}
+
+// Send emits an event to all sockets connected to the namespace. It returns the first error, if any.
+func (n *ServerNamespace) Send(data []interface{}) error {
+	var first error
+	for _, s := range n.Sockets() {
+		if err := s.Send(data); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// connect adds a new socket of c to the namespace and calls the OnConnect handler.
+func (n *ServerNamespace) connect(c *serverConn) error {
+	s := &Socket{conn: c, nsp: n, acks: newAckTable(0)}
+	if err := c.sendPacket(Packet{Type: Connect, Namespace: n.name}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.sockets[n.name] = s
+	c.mu.Unlock()
+	n.mu.Lock()
+	n.sockets[s.ID()] = s
+	fn := n.onConnect
+	n.mu.Unlock()
+	if fn != nil {
+		fn(s)
+	}
+	return nil
+}
+
+// Socket is a client connected to a namespace of a Server.
+type Socket struct {
+	conn   *serverConn
+	nsp    *ServerNamespace
+	events router
+	acks   *ackTable
+
+	mu           sync.Mutex
+	onDisconnect func(reason string)
+	disconnected bool
+}
+
+// ID returns the ID of the socket, which is the Engine.IO session ID prefixed by the namespace
+// except for the default namespace, as in socket.io v2.
+func (s *Socket) ID() string {
+	if s.nsp.name == DefaultNamespace {
+		return s.conn.sess.ID()
+	}
+	return s.nsp.name + "#" + s.conn.sess.ID()
+}
+
+// Namespace returns the name of the namespace the socket is connected to.
+func (s *Socket) Namespace() string {
+	return s.nsp.name
+}
+
+// Request returns the handshake request of the connection.
+func (s *Socket) Request() *http.Request {
+	return s.conn.sess.Request()
+}
+
+// Connected reports whether the socket is still connected.
+func (s *Socket) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.disconnected
+}
+
+// On registers f to handle the event named event from the client. See Namespace.On.
+func (s *Socket) On(event string, f interface{}) {
+	s.events.on(event, f)
+}
+
+// Off removes the handler of event registered by On.
+func (s *Socket) Off(event string) {
+	s.events.off(event)
+}
+
+// Handle sets the catch-all handler of events without handlers registered by On.
+func (s *Socket) Handle(h Handler) {
+	s.events.handle(h)
+}
+
+// HandleFunc sets the catch-all handler of events.
+func (s *Socket) HandleFunc(fn func(p *Packet)) {
+	s.Handle(HandlerFunc(fn))
+}
+
+// OnDisconnect sets fn to be called with the reason when the socket is disconnected.
+func (s *Socket) OnDisconnect(fn func(reason string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDisconnect = fn
+}
+
+// SetAckTimeout sets the default timeout of SendPacketAck and SendAck. Zero, the default, waits forever.
+func (s *Socket) SetAckTimeout(d time.Duration) {
+	s.acks.setTimeout(d)
+}
+
+// SendPacket sends p to the client in the namespace of the socket.
+func (s *Socket) SendPacket(p Packet) error {
+	if !s.Connected() {
+		return ErrorDisconnected
+	}
+	p.Namespace = s.nsp.name
+	return s.conn.sendPacket(p)
+}
+
+// SendPacketAck sends p and waits for its ack until the timeout set by SetAckTimeout.
+func (s *Socket) SendPacketAck(p Packet) ([]interface{}, error) {
+	return s.acks.sendWait(p, s.acks.getTimeout(), s.SendPacket, s.conn.server.logger)
+}
+
+// GoPacket sends p without waiting for its ack. See Client.GoPacket.
+func (s *Socket) GoPacket(p Packet, done chan *Call) *Call {
+	return goPacket(s.acks, p, done, s.SendPacket, s.conn.server.logger)
+}
+
+// Send emits an event to the client.
+func (s *Socket) Send(data []interface{}) error {
+	return s.SendPacket(Packet{Type: Event, Data: data})
+}
+
+// SendAck emits an event to the client and waits for its ack.
+func (s *Socket) SendAck(data []interface{}) ([]interface{}, error) {
+	return s.SendPacketAck(Packet{Type: Event, Data: data})
+}
+
+// Go emits an event to the client without waiting for its ack. See Client.GoPacket.
+func (s *Socket) Go(data []interface{}, done chan *Call) *Call {
+	return s.GoPacket(Packet{Type: Event, Data: data}, done)
+}
+
+// SendAckFunc emits an event to the client without waiting for its ack, and calls fn with the result of the ack
+// in another goroutine. See Client.GoPacket.
+func (s *Socket) SendAckFunc(data []interface{}, fn func(ack []interface{}, err error)) {
+	call := s.Go(data, nil)
+	go func() {
+		<-call.Done
+		fn(call.Ack, call.Error)
+	}()
+}
+
+// SendBinary emits an event whose []byte are sent as binary attachments.
+func (s *Socket) SendBinary(data []interface{}) error {
+	return s.SendPacket(Packet{Type: BinaryEvent, Data: data})
+}
+
+// SendBinaryAck emits an event whose []byte are sent as binary attachments, and waits for its ack.
+func (s *Socket) SendBinaryAck(data []interface{}) ([]interface{}, error) {
+	return s.SendPacketAck(Packet{Type: BinaryEvent, Data: data})
+}
+
+// Disconnect disconnects the socket from its namespace. The connection is closed if the namespace is the default one.
+func (s *Socket) Disconnect() error {
+	if s.nsp.name == DefaultNamespace {
+		s.conn.close(ReasonServerDisconnect)
+		return nil
+	}
+	err := s.SendPacket(Packet{Type: Disconnect})
+	s.conn.removeSocket(s.nsp.name, ReasonServerDisconnect)
+	return err
+}
+
+// disconnect removes s from its namespace and calls the OnDisconnect handler.
+func (s *Socket) disconnect(reason string) {
+	s.mu.Lock()
+	if s.disconnected {
+		s.mu.Unlock()
+		return
+	}
+	s.disconnected = true
+	fn := s.onDisconnect
+	s.mu.Unlock()
+	s.nsp.mu.Lock()
+	delete(s.nsp.sockets, s.ID())
+	s.nsp.mu.Unlock()
+	s.acks.close(errors.New(reason))
+	if fn != nil {
+		fn(reason)
+	}
+}
+
+// serverConn is an Engine.IO session of a Server, multiplexing the sockets of namespaces.
+type serverConn struct {
+	server *Server
+	sess   *eventio.Session
+
+	// sendMu keeps a packet and its attachments together.
+	sendMu    sync.Mutex
+	mu        sync.Mutex
+	sockets   map[string]*Socket
+	closeOnce sync.Once
+
+	// binary is the BinaryEvent or BinaryAck waiting for its attachments in buffers.
+	binary  *Packet
+	buffers [][]byte
+}
+
+// sendPacket sends p and its attachments.
+func (c *serverConn) sendPacket(p Packet) error {
+	var buffers [][]byte
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		p, buffers = DeconstructPacket(p)
+	}
+	s, err := EncodePacket(p)
+	if err != nil {
+		return err
+	}
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	err = c.sess.Send(s)
+	for _, b := range buffers {
+		if err != nil {
+			break
+		}
+		err = c.sess.SendBinary(b)
+	}
+	if errors.Is(err, eventio.ErrorClosed) {
+		return ErrorDisconnected
+	}
+	return err
+}
+
+func (c *serverConn) socket(nsp string) *Socket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sockets[nsp]
+}
+
+func (c *serverConn) removeSocket(nsp string, reason string) {
+	c.mu.Lock()
+	s := c.sockets[nsp]
+	delete(c.sockets, nsp)
+	c.mu.Unlock()
+	if s != nil {
+		s.disconnect(reason)
+	}
+}
+
+// close disconnects the sockets of the connection with reason and closes the session.
+func (c *serverConn) close(reason string) {
+	c.closeOnce.Do(func() {
+		c.removeSockets(reason)
+		c.sess.Close()
+	})
+}
+
+func (c *serverConn) removeSockets(reason string) {
+	c.server.mu.Lock()
+	delete(c.server.conns, c.sess.ID())
+	c.server.mu.Unlock()
+	c.mu.Lock()
+	var names []string
+	for nsp := range c.sockets {
+		names = append(names, nsp)
+	}
+	c.mu.Unlock()
+	for _, nsp := range names {
+		c.removeSocket(nsp, reason)
+	}
+}
+
+// HandleClose disconnects the sockets when the session is closed.
+func (c *serverConn) HandleClose(err error) {
+	reason := ReasonServerDisconnect
+	if err != nil {
+		reason = eventio.DisconnectReason(err)
+	}
+	c.removeSockets(reason)
+}
+
+func (c *serverConn) HandleMessage(msg string) {
+	c.handleMessage(msg)
+}
+
+func (c *serverConn) HandleBinaryMessage(data []byte) {
+	c.handleBinaryMessage(data)
+}
+
+func (c *serverConn) handleMessage(msg string) {
+	p, err := DecodePacket(msg)
+	if err != nil {
+		c.server.logger.Log("failed to decode packet", err)
+		return
+	}
+	if (p.Type == BinaryEvent || p.Type == BinaryAck) && p.Attachments > 0 {
+		c.binary = &p
+		c.buffers = nil
+		return
+	}
+	c.dispatch(p)
+}
+
+func (c *serverConn) handleBinaryMessage(data []byte) {
+	if c.binary == nil {
+		c.server.logger.Log("received unexpected attachment")
+		return
+	}
+	c.buffers = append(c.buffers, data)
+	if len(c.buffers) < c.binary.Attachments {
+		return
+	}
+	p, err := ReconstructPacket(*c.binary, c.buffers)
+	c.binary = nil
+	c.buffers = nil
+	if err != nil {
+		c.server.logger.Log("failed to reconstruct binary packet", err)
+		return
+	}
+	c.dispatch(p)
+}
+
+func (c *serverConn) dispatch(p Packet) {
+	logger := c.server.logger
+	if p.Type == Connect {
+		if c.socket(p.Namespace) != nil {
+			return
+		}
+		n := c.server.namespace(p.Namespace)
+		if n == nil {
+			if err := c.sendPacket(Packet{Type: Error, Namespace: p.Namespace, Data: []interface{}{"Invalid namespace"}}); err != nil {
+				logger.Log("failed to refuse namespace", err)
+			}
+			return
+		}
+		if err := n.connect(c); err != nil {
+			logger.Log("failed to connect namespace", p.Namespace, err)
+		}
+		return
+	}
+	s := c.socket(p.Namespace)
+	if s == nil {
+		logger.Log("received packet of unconnected namespace", p.Namespace)
+		return
+	}
+	switch p.Type {
+	case Disconnect:
+		c.removeSocket(p.Namespace, ReasonClientDisconnect)
+	case Event, BinaryEvent:
+		s.events.route(&p, s.SendPacket, logger)
+	case Ack, BinaryAck:
+		if p.ID == nil {
+			logger.Log("received ack without id")
+		} else if !s.acks.resolve(*p.ID, p.Data) {
+			logger.Log("received ack of unknown id", *p.ID)
+		}
+	default:
+		logger.Log("received ignoring type", p.Type)
+	}
+}
@@ -0,0 +1,127 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name       string
+		transports []string
+	}{
+		{"websocket", []string{eventio.TransportWebsocket}},
+		{"polling", []string{eventio.TransportPolling}},
+		{"upgrade", []string{eventio.TransportPolling, eventio.TransportWebsocket}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			testServer(t, test.transports)
+		})
+	}
+}
+
+func testServer(t *testing.T, transports []string) {
+	s := NewServer(nopLogger{})
+	disconnected := make(chan string, 2)
+	hello := make(chan *Call, 1)
+	s.OnConnect(func(socket *Socket) {
+		socket.On("add", func(a int, b int) int {
+			return a + b
+		})
+		socket.On("blob", func(b []byte) []byte {
+			return append(b, 2)
+		})
+		socket.OnDisconnect(func(reason string) {
+			disconnected <- reason
+		})
+		socket.Go([]interface{}{"hello", "client"}, hello)
+	})
+	chat := s.Of("/chat")
+	chat.OnConnect(func(socket *Socket) {
+		if !strings.HasPrefix(socket.ID(), "/chat#") {
+			t.Error("id mismatch", socket.ID())
+		}
+		socket.OnDisconnect(func(reason string) {
+			disconnected <- reason
+		})
+	})
+	server := httptest.NewServer(s)
+	defer server.Close()
+	defer s.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	c.SetTransports(transports...)
+	c.On("hello", func(name string) string {
+		return "hi " + name
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case call := <-hello:
+		if call.Error != nil || len(call.Ack) != 1 || string(call.Ack[0].(json.RawMessage)) != `"hi client"` {
+			t.Error("ack from the client mismatch", call.Ack, call.Error)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no ack from the client")
+	}
+
+	ack, err := c.SendAck([]interface{}{"add", 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 1 || string(ack[0].(json.RawMessage)) != "3" {
+		t.Error("ack mismatch", ack)
+	}
+	ack, err = c.SendBinaryAck([]interface{}{"blob", []byte{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 1 || !reflect.DeepEqual(ack[0], []byte{1, 2}) {
+		t.Error("binary ack mismatch", ack)
+	}
+
+	if err := c.Of("/chat").Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(chat.Sockets()); n != 1 {
+		t.Error("socket of /chat should be connected", n)
+	}
+	var ce *ConnectError
+	if err := c.Of("/unknown").Connect(); !errors.As(err, &ce) || string(ce.Data) != `"Invalid namespace"` {
+		t.Error("unknown namespace should be refused", err)
+	}
+	if err := c.Of("/chat").Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reason := <-disconnected:
+		if reason != ReasonClientDisconnect {
+			t.Error("reason mismatch", reason)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("socket of /chat is not disconnected")
+	}
+
+	c.Close()
+	select {
+	case reason := <-disconnected:
+		if reason != ReasonTransportClose && reason != ReasonTransportError {
+			t.Error("reason mismatch", reason)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("socket is not disconnected")
+	}
+	if n := len(s.Of(DefaultNamespace).Sockets()); n != 0 {
+		t.Error("disconnected sockets should be removed", n)
+	}
+}
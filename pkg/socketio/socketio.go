@@ -5,15 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/neguse/gomelift/pkg/eventio"
 	"github.com/neguse/gomelift/pkg/log"
 )
 
 var (
-	ErrorEmptyPacket = errors.New("Packet length should be at least 1 byte")
-	ErrorNullPacket  = errors.New("Packet length should be at least 1")
+	ErrorEmptyPacket   = errors.New("Packet length should be at least 1 byte")
+	ErrorNullPacket    = errors.New("Packet length should be at least 1")
+	ErrorInvalidPacket = errors.New("Packet is malformed")
 )
 
 type PacketType int
@@ -49,26 +52,48 @@ func (pt PacketType) String() string {
 	}
 }
 
+// DefaultNamespace is the namespace of packets without one.
+const DefaultNamespace = "/"
+
 type Packet struct {
 	Type PacketType
-	ID   *int
-	Data []interface{}
+	// Namespace is the namespace of the packet. Empty means DefaultNamespace.
+	Namespace string
+	// Attachments is the number of binary attachments following BinaryEvent and BinaryAck.
+	Attachments int `json:",omitempty"`
+	ID          *int
+	Data        []interface{}
 }
 
 func NewAckPacket(p *Packet, data []interface{}) Packet {
 	return Packet{
-		Type: Ack,
-		ID:   p.ID,
-		Data: data,
+		Type:      Ack,
+		Namespace: p.Namespace,
+		ID:        p.ID,
+		Data:      data,
 	}
 }
 
+// namespaceOf returns the namespace of p, which is DefaultNamespace if empty.
+func namespaceOf(p *Packet) string {
+	if p.Namespace == "" {
+		return DefaultNamespace
+	}
+	return p.Namespace
+}
+
 func EncodePacket(p Packet) (string, error) {
 	var (
 		data []byte
 		err  error
 	)
-	if len(p.Data) > 0 {
+	if (p.Type == Connect || p.Type == Error) && len(p.Data) == 1 {
+		// a namespace connection and its error carry a bare JSON value
+		data, err = json.Marshal(p.Data[0])
+		if err != nil {
+			return "", err
+		}
+	} else if len(p.Data) > 0 {
 		data, err = json.Marshal(p.Data)
 		if err != nil {
 			return "", err
@@ -76,45 +101,107 @@ func EncodePacket(p Packet) (string, error) {
 	} else {
 		data = []byte{}
 	}
-	var idStr string
-	if p.ID != nil {
-		idStr = fmt.Sprint(*p.ID)
+	buf := make([]byte, 0, len(p.Namespace)+len(data)+16)
+	buf = strconv.AppendInt(buf, int64(p.Type), 10)
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		buf = strconv.AppendInt(buf, int64(p.Attachments), 10)
+		buf = append(buf, '-')
+	}
+	if p.Namespace != "" && p.Namespace != DefaultNamespace {
+		buf = append(buf, p.Namespace...)
+		buf = append(buf, ',')
 	}
-	return fmt.Sprintf("%d%v%v", p.Type, idStr, string(data)), nil
+	if p.ID != nil && p.Type != Error {
+		buf = strconv.AppendInt(buf, int64(*p.ID), 10)
+	}
+	return string(append(buf, data...)), nil
 }
 
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// parseUint parses s of decimal digits only, which are at most 9 not to overflow.
+func parseUint(s string) (int, bool) {
+	if len(s) == 0 || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
 func DecodePacket(data string) (Packet, error) {
 	var p Packet
 	if len(data) == 0 {
 		return p, ErrorEmptyPacket
 	}
-	typ, err := strconv.Atoi(data[0:1])
-	if err != nil {
-		return p, err
+	// the type is a single digit, followed by the digits of the attachments or the ID
+	if data[0] < '0' || data[0] > '0'+byte(BinaryAck) {
+		return p, fmt.Errorf("%w: unknown packet type %q", ErrorInvalidPacket, data[0])
 	}
-	p.Type = PacketType(typ)
-	if p.Type != Event && p.Type != Ack && p.Type != Error {
-		return p, nil
+	p.Type = PacketType(data[0] - '0')
+	p.Namespace = DefaultNamespace
+	i := 1
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		n := strings.IndexByte(data, '-')
+		if n < 0 {
+			return p, ErrorInvalidPacket
+		}
+		var ok bool
+		if p.Attachments, ok = parseUint(data[1:n]); !ok {
+			return p, ErrorInvalidPacket
+		}
+		i = n + 1
 	}
-	var i int
-	for i = 1; i < len(data); i++ {
-		if !isDigit(data[i]) {
-			break
+	if i < len(data) && data[i] == '/' {
+		if n := strings.IndexByte(data[i:], ','); n >= 0 {
+			p.Namespace = data[i : i+n]
+			i += n + 1
+		} else {
+			p.Namespace = data[i:]
+			i = len(data)
 		}
 	}
-	//log.Println(data, i)
-	if i > 1 {
-		pid, err := strconv.Atoi(data[1:i])
-		if err != nil {
-			return p, err
+	if p.Type == Connect && i < len(data) {
+		// the auth payload or the session ID of socket.io v3 and later
+		if !json.Valid([]byte(data[i:])) {
+			return p, ErrorInvalidPacket
+		}
+		p.Data = append(p.Data, json.RawMessage(data[i:]))
+		return p, nil
+	}
+	if p.Type != Event && p.Type != Ack && p.Type != Error && p.Type != BinaryEvent && p.Type != BinaryAck {
+		return p, nil
+	}
+	j := i
+	// an error never carries an ack ID, and its payload may be a bare number
+	for p.Type != Error && j < len(data) && isDigit(data[j]) {
+		j++
+	}
+	if j > i {
+		pid, ok := parseUint(data[i:j])
+		if !ok {
+			return p, ErrorInvalidPacket
 		}
 		p.ID = &pid
 	}
-	//log.Println(data, i, data[i:])
+	i = j
+	if p.Type == Error && (i == len(data) || data[i] != '[') {
+		// an error of a namespace connection carries a bare JSON value, or nothing
+		if i < len(data) {
+			if !json.Valid([]byte(data[i:])) {
+				return p, ErrorInvalidPacket
+			}
+			p.Data = append(p.Data, json.RawMessage(data[i:]))
+		}
+		return p, nil
+	}
 	var msgs []json.RawMessage
 	if err := json.Unmarshal([]byte(data[i:]), &msgs); err != nil {
 		return p, err
@@ -122,9 +209,9 @@ func DecodePacket(data string) (Packet, error) {
 	if len(msgs) == 0 {
 		return p, ErrorNullPacket
 	}
-	//log.Println(msgs)
-	for _, msg := range msgs {
-		p.Data = append(p.Data, msg)
+	p.Data = make([]interface{}, len(msgs))
+	for k, msg := range msgs {
+		p.Data[k] = msg
 	}
 	return p, nil
 }
@@ -145,95 +232,269 @@ func (f HandlerFunc) HandleMessage(packet *Packet) {
 }
 
 type Client struct {
-	c       *eventio.Client
-	handler Handler
-	reqId   int
-	ackCh   map[int]chan []interface{}
-	ackChMu sync.Mutex
-	logger  log.Logger
+	c          *eventio.Client
+	acks       *ackTable
+	namespaces map[string]*Namespace
+	nspMu      sync.Mutex
+	sendMu     sync.Mutex
+	logger     log.Logger
+	// auth is sent with namespace connections in socket.io v3 and later.
+	auth      interface{}
+	lifecycle func(e eventio.LifecycleEvent)
+
+	// binary is the BinaryEvent or BinaryAck waiting for its attachments in buffers.
+	binary  *Packet
+	buffers [][]byte
 }
 
 func NewClient(url string, logger log.Logger) *Client {
 	ec := eventio.NewClient(url, logger)
 	c := &Client{
-		c:       ec,
-		handler: &nullHandler{},
-		reqId:   10000,
-		ackCh:   make(map[int]chan []interface{}),
-		logger:  logger,
+		c:          ec,
+		acks:       newAckTable(10000),
+		namespaces: make(map[string]*Namespace),
+		logger:     logger,
 	}
+	c.Of(DefaultNamespace)
 	ec.Handle(c)
 	return c
 }
 
 func (c *Client) NextReqID() int {
-	c.reqId++
-	reqID := c.reqId
-	return reqID
+	return c.acks.nextID()
+}
+
+// Of returns the namespace nsp of the client. Call Connect on it to join a namespace other than the default one.
+func (c *Client) Of(nsp string) *Namespace {
+	c.nspMu.Lock()
+	defer c.nspMu.Unlock()
+	n, ok := c.namespaces[nsp]
+	if !ok {
+		n = &Namespace{client: c, name: nsp, events: router{handler: &nullHandler{}}}
+		c.namespaces[nsp] = n
+	}
+	return n
 }
 
+func (c *Client) namespace(nsp string) *Namespace {
+	c.nspMu.Lock()
+	defer c.nspMu.Unlock()
+	return c.namespaces[nsp]
+}
+
+// On registers f to handle the event named event in the default namespace. See Namespace.On.
+func (c *Client) On(event string, f interface{}) {
+	c.Of(DefaultNamespace).On(event, f)
+}
+
+// Handle sets the catch-all handler of events in the default namespace.
 func (c *Client) Handle(h Handler) {
-	c.handler = h
+	c.Of(DefaultNamespace).Handle(h)
 }
 
+// HandleFunc sets the catch-all handler of events in the default namespace.
 func (c *Client) HandleFunc(fn func(p *Packet)) {
-	c.handler = HandlerFunc(fn)
+	c.Of(DefaultNamespace).HandleFunc(fn)
+}
+
+// HookFrame sets h to observe raw Engine.IO frames. It should be called before Open.
+func (c *Client) HookFrame(h eventio.FrameHook) {
+	c.c.HookFrame(h)
 }
 
 // HandleMessage handles Event.IO Message.
 func (c *Client) HandleMessage(msg string) {
 	p, err := DecodePacket(msg)
 	if err != nil {
-		c.logger.Panic("failed to DecodePacket", err)
+		c.logger.Log("failed to DecodePacket", err)
+		c.emitError(err)
+		return
 	}
 	c.logger.Log("recv", p.Type)
-	switch p.Type {
-	case Event:
-		c.handler.HandleMessage(&p)
-	case Ack:
+	if (p.Type == BinaryEvent || p.Type == BinaryAck) && p.Attachments > 0 {
+		c.binary = &p
+		c.buffers = nil
+		return
+	}
+	c.dispatch(p)
+}
+
+// HandleBinaryMessage handles an attachment of the pending BinaryEvent or BinaryAck.
+func (c *Client) HandleBinaryMessage(data []byte) {
+	if c.binary == nil {
+		c.logger.Log("received unexpected attachment")
+		return
+	}
+	c.buffers = append(c.buffers, data)
+	if len(c.buffers) < c.binary.Attachments {
+		return
+	}
+	p, err := ReconstructPacket(*c.binary, c.buffers)
+	c.binary = nil
+	c.buffers = nil
+	if err != nil {
+		c.logger.Log("failed to reconstruct binary packet", err)
+		c.emitError(err)
+		return
+	}
+	c.dispatch(p)
+}
+
+func (c *Client) dispatch(p Packet) {
+	if p.Type == Ack || p.Type == BinaryAck {
+		if p.ID == nil {
+			c.logger.Log("received ack without id")
+			return
+		}
 		c.logger.Log("recv ack id", *p.ID)
-		c.ackChMu.Lock()
-		if ackCh, ok := c.ackCh[*p.ID]; ok {
-			ackCh <- p.Data
-			delete(c.ackCh, *p.ID)
+		if !c.acks.resolve(*p.ID, p.Data) {
+			c.logger.Log("received ack of unknown id", *p.ID)
 		}
-		c.ackChMu.Unlock()
+		return
+	}
+	n := c.namespace(p.Namespace)
+	if n == nil {
+		c.logger.Log("received packet of unknown namespace", p.Namespace)
+		return
+	}
+	switch p.Type {
+	case Connect:
+		n.setID(connectedID(&p))
+		n.connectResult(nil)
+	case Disconnect:
+		n.setConnected(false)
+	case Error:
+		var data json.RawMessage
+		if len(p.Data) > 0 {
+			data = p.Data[0].(json.RawMessage)
+		}
+		n.connectResult(&ConnectError{Namespace: p.Namespace, Data: data})
+	case Event, BinaryEvent:
+		n.events.route(&p, c.SendPacket, c.logger)
 	default:
 		c.logger.Log("received ignoring type", p.Type)
 	}
+}
+
+// SetProtocol selects the Engine.IO protocol version. It should be called before Open.
+// The default, eventio.ProtocolAuto, negotiates socket.io v2 or v3 and later with the server.
+func (c *Client) SetProtocol(p eventio.Protocol) {
+	c.c.SetProtocol(p)
+}
+
+// OnLifecycle sets fn to receive the lifecycle events of the connection. It should be called before Open.
+// Besides those of eventio.Client, LifecycleError is emitted for socket.io packets failing to decode,
+// which are dropped.
+func (c *Client) OnLifecycle(fn func(e eventio.LifecycleEvent)) {
+	c.lifecycle = fn
+	c.c.OnLifecycle(fn)
+}
+
+func (c *Client) emitError(err error) {
+	if c.lifecycle != nil {
+		c.lifecycle(eventio.LifecycleEvent{Type: eventio.LifecycleError, Err: err})
+	}
+}
+
+// SetTransports sets the Engine.IO transports to try in order. See eventio.Client.SetTransports.
+func (c *Client) SetTransports(transports ...string) {
+	c.c.SetTransports(transports...)
+}
 
+// SetDialOptions sets how the Engine.IO transports connect to the server. See eventio.Client.SetDialOptions.
+func (c *Client) SetDialOptions(o eventio.DialOptions) {
+	c.c.SetDialOptions(o)
 }
 
+// SetQueueOptions configures the send queue of the Engine.IO connection. See eventio.Client.SetQueueOptions.
+func (c *Client) SetQueueOptions(o eventio.QueueOptions) {
+	c.c.SetQueueOptions(o)
+}
+
+// QueueStats returns the statistics of the send queue of the Engine.IO connection.
+func (c *Client) QueueStats() eventio.QueueStats {
+	return c.c.QueueStats()
+}
+
+// SetAuth sets the auth payload sent with namespace connections in socket.io v3 and later,
+// such as map[string]string{"token": token}. It should be called before Open.
+func (c *Client) SetAuth(auth interface{}) {
+	c.auth = auth
+}
+
+// v5 reports whether the connection speaks socket.io v3 and later, which is the protocol revision 5.
+func (c *Client) v5() bool {
+	return c.c.Protocol() == eventio.Protocol4
+}
+
+// Open opens the connection. In socket.io v3 and later, it also connects to the default namespace
+// and waits for the server to accept it; a refusal is returned as *ConnectError.
 func (c *Client) Open() error {
-	return c.c.Open()
+	if err := c.c.Open(); err != nil {
+		return err
+	}
+	if !c.v5() {
+		// the server connects the default namespace
+		return nil
+	}
+	if err := c.Of(DefaultNamespace).Connect(); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// Close closes the underlying Engine.IO connection. Pending acks fail with ErrorDisconnected.
+func (c *Client) Close() error {
+	err := c.c.Close()
+	c.HandleClose(nil)
+	return err
 }
 
+// Connected reports whether the underlying Engine.IO connection is open.
+func (c *Client) Connected() bool {
+	return c.c.Connected()
+}
+
+// RTT returns the round-trip time of the Engine.IO connection. See eventio.Client.RTT.
+func (c *Client) RTT() time.Duration {
+	return c.c.RTT()
+}
+
+// SendPacket sends p. []byte in the data of BinaryEvent and BinaryAck are sent as attachments,
+// while those of Event and Ack are encoded in base64.
 func (c *Client) SendPacket(p Packet) error {
+	var buffers [][]byte
+	if p.Type == BinaryEvent || p.Type == BinaryAck {
+		p, buffers = DeconstructPacket(p)
+	}
 	s, err := EncodePacket(p)
 	if err != nil {
 		return err
 	}
 	c.logger.Log("sending", s)
-	c.c.Send(s)
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if err := c.c.Send(s); err != nil {
+		return err
+	}
+	for _, b := range buffers {
+		if err := c.c.SendBinary(b); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// SendPacketAck sends p and waits for its ack until the timeout set by SetAckTimeout.
 func (c *Client) SendPacketAck(p Packet) ([]interface{}, error) {
-	reqID := c.NextReqID()
-	p.ID = &reqID
-	s, err := EncodePacket(p)
-	if err != nil {
-		return nil, err
-	}
-	c.ackChMu.Lock()
-	c.ackCh[reqID] = make(chan []interface{})
-	c.ackChMu.Unlock()
-	c.logger.Log("sending need ack", reqID, s)
-	c.c.Send(s)
+	return c.SendPacketAckTimeout(p, c.acks.getTimeout())
+}
 
-	ack := <-c.ackCh[reqID]
-	c.logger.Log("received ack", ack)
-	return ack, nil
+// SendPacketAckTimeout sends p and waits for its ack until timeout, forever if timeout is zero.
+// It fails with ErrorAckTimeout on timeout, and with ErrorDisconnected if the connection is closed.
+func (c *Client) SendPacketAckTimeout(p Packet, timeout time.Duration) ([]interface{}, error) {
+	return c.acks.sendWait(p, timeout, c.SendPacket, c.logger)
 }
 
 func (c *Client) Send(data []interface{}) error {
@@ -253,3 +514,18 @@ func (c *Client) SendAck(data []interface{}) ([]interface{}, error) {
 	}
 	return c.SendPacketAck(p)
 }
+
+// SendAckTimeout emits an event and waits for its ack until timeout. See SendPacketAckTimeout.
+func (c *Client) SendAckTimeout(data []interface{}, timeout time.Duration) ([]interface{}, error) {
+	return c.SendPacketAckTimeout(Packet{Type: Event, Data: data}, timeout)
+}
+
+// SendBinary emits an event whose []byte are sent as binary attachments.
+func (c *Client) SendBinary(data []interface{}) error {
+	return c.SendPacket(Packet{Type: BinaryEvent, Data: data})
+}
+
+// SendBinaryAck emits an event whose []byte are sent as binary attachments, and waits for its ack.
+func (c *Client) SendBinaryAck(data []interface{}) ([]interface{}, error) {
+	return c.SendPacketAck(Packet{Type: BinaryEvent, Data: data})
+}
@@ -0,0 +1,425 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/neguse/gomelift/pkg/eventio"
+)
+
+type nopLogger struct{}
+
+func (l nopLogger) Log(msg string, args ...interface{}) {}
+
+func (l nopLogger) Panic(msg string, args ...interface{}) {
+	panic(fmt.Sprint(msg, args))
+}
+
+func intAddr(i int) *int {
+	return &i
+}
+
+func TestEncodePacket(t *testing.T) {
+	tests := []struct {
+		p      Packet
+		expect string
+	}{
+		{Packet{Type: Connect}, "0"},
+		{Packet{Type: Disconnect}, "1"},
+		{Packet{Type: Event, Data: []interface{}{"name", 1}}, `2["name",1]`},
+		{Packet{Type: Event, ID: intAddr(12), Data: []interface{}{"name", []byte{1, 2}}}, `212["name","AQI="]`},
+		{Packet{Type: Ack, ID: intAddr(3), Data: []interface{}{true}}, `33[true]`},
+		{Packet{Type: Connect, Namespace: "/"}, "0"},
+		{Packet{Type: Connect, Namespace: "/chat"}, "0/chat,"},
+		{Packet{Type: Connect, Namespace: "/chat", Data: []interface{}{map[string]string{"token": "abc"}}}, `0/chat,{"token":"abc"}`},
+		{Packet{Type: Event, Namespace: "/chat", ID: intAddr(5), Data: []interface{}{"name"}}, `2/chat,5["name"]`},
+		{Packet{Type: Ack, Namespace: "/chat", ID: intAddr(5), Data: []interface{}{true}}, `3/chat,5[true]`},
+		{Packet{Type: BinaryEvent, Attachments: 1, Data: []interface{}{"name", placeholder{true, 0}}}, `51-["name",{"_placeholder":true,"num":0}]`},
+		{Packet{Type: BinaryAck, Namespace: "/chat", Attachments: 2, ID: intAddr(5), Data: []interface{}{1}}, `62-/chat,5[1]`},
+	}
+	for _, test := range tests {
+		s, err := EncodePacket(test.p)
+		if err != nil {
+			t.Error(err)
+		}
+		if s != test.expect {
+			t.Errorf("encode mismatch: %q, expected %q", s, test.expect)
+		}
+	}
+}
+
+func TestDecodePacket(t *testing.T) {
+	tests := []struct {
+		s   string
+		typ PacketType
+		nsp string
+		id  *int
+
+		attachments int
+		data        []string
+		hasErr      bool
+	}{
+		{s: "0", typ: Connect},
+		{s: "1", typ: Disconnect},
+		{s: `2["name",{"a":1}]`, typ: Event, data: []string{`"name"`, `{"a":1}`}},
+		{s: `212["name"]`, typ: Event, id: intAddr(12), data: []string{`"name"`}},
+		{s: `33[true,"x"]`, typ: Ack, id: intAddr(3), data: []string{`true`, `"x"`}},
+		{s: `4["error"]`, typ: Error, data: []string{`"error"`}},
+		{s: "", hasErr: true},
+		{s: "x", hasErr: true},
+		{s: "2[]", typ: Event, hasErr: true},
+		{s: "2[", typ: Event, hasErr: true},
+		{s: "0/chat,", typ: Connect, nsp: "/chat"},
+		{s: "0/chat", typ: Connect, nsp: "/chat"},
+		{s: "1/chat,", typ: Disconnect, nsp: "/chat"},
+		{s: `0{"sid":"s1"}`, typ: Connect, data: []string{`{"sid":"s1"}`}},
+		{s: `0/chat,{"sid":"s1"}`, typ: Connect, nsp: "/chat", data: []string{`{"sid":"s1"}`}},
+		{s: `0/chat,{`, typ: Connect, hasErr: true},
+		{s: `2/chat,["name"]`, typ: Event, nsp: "/chat", data: []string{`"name"`}},
+		{s: `2/chat,12["name"]`, typ: Event, nsp: "/chat", id: intAddr(12), data: []string{`"name"`}},
+		{s: `3/chat,12[true]`, typ: Ack, nsp: "/chat", id: intAddr(12), data: []string{`true`}},
+		{s: `4/chat,"Invalid namespace"`, typ: Error, nsp: "/chat", data: []string{`"Invalid namespace"`}},
+		{s: `4/chat,{"message":"unauthorized"}`, typ: Error, nsp: "/chat", data: []string{`{"message":"unauthorized"}`}},
+		{s: `4/chat,{`, typ: Error, hasErr: true},
+		{s: `51-["name",{"_placeholder":true,"num":0}]`, typ: BinaryEvent, attachments: 1, data: []string{`"name"`, `{"_placeholder":true,"num":0}`}},
+		{s: `62-/chat,5[1]`, typ: BinaryAck, nsp: "/chat", attachments: 2, id: intAddr(5), data: []string{`1`}},
+		{s: `5["name"]`, typ: BinaryEvent, hasErr: true},
+		{s: `5+1-["name"]`, typ: BinaryEvent, hasErr: true},
+		{s: `5-["name"]`, typ: BinaryEvent, hasErr: true},
+		{s: `7["name"]`, hasErr: true},
+		{s: `2999999999999999999999["name"]`, typ: Event, hasErr: true},
+		{s: `4`, typ: Error},
+		{s: `4123`, typ: Error, data: []string{`123`}},
+		{s: `4/chat,5[1]`, typ: Error, hasErr: true},
+	}
+	for _, test := range tests {
+		p, err := DecodePacket(test.s)
+		if (err != nil) != test.hasErr {
+			t.Errorf("%q: error mismatch: %v", test.s, err)
+			continue
+		}
+		if test.hasErr {
+			continue
+		}
+		if p.Type != test.typ {
+			t.Errorf("%q: type mismatch: %v, expected %v", test.s, p.Type, test.typ)
+		}
+		nsp := test.nsp
+		if nsp == "" {
+			nsp = DefaultNamespace
+		}
+		if p.Namespace != nsp {
+			t.Errorf("%q: namespace mismatch: %q, expected %q", test.s, p.Namespace, nsp)
+		}
+		if p.Attachments != test.attachments {
+			t.Errorf("%q: attachments mismatch: %v, expected %v", test.s, p.Attachments, test.attachments)
+		}
+		if (p.ID == nil) != (test.id == nil) || (p.ID != nil && *p.ID != *test.id) {
+			t.Errorf("%q: id mismatch: %v, expected %v", test.s, p.ID, test.id)
+		}
+		if len(p.Data) != len(test.data) {
+			t.Errorf("%q: data mismatch: %v, expected %v", test.s, p.Data, test.data)
+			continue
+		}
+		for i, d := range p.Data {
+			if string(d.(json.RawMessage)) != test.data[i] {
+				t.Errorf("%q: data mismatch: %s, expected %s", test.s, d, test.data[i])
+			}
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			recv <- string(data)
+			if strings.HasPrefix(string(data), "4210001") {
+				conn.WriteMessage(websocket.TextMessage, []byte(`4310001["pong"]`))
+				conn.WriteMessage(websocket.TextMessage, []byte(`427["ping"]`))
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	c.HandleFunc(func(p *Packet) {
+		if err := c.SendPacket(NewAckPacket(p, []interface{}{"ack"})); err != nil {
+			panic(err)
+		}
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Send([]interface{}{"hello"}); err != nil {
+		t.Fatal(err)
+	}
+	ack, err := c.SendAck([]interface{}{"ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 1 || string(ack[0].(json.RawMessage)) != `"pong"` {
+		t.Error("ack mismatch", ack)
+	}
+
+	expect := []string{`42["hello"]`, `4210001["ping"]`, `437["ack"]`}
+	for _, e := range expect {
+		select {
+		case s := <-recv:
+			if s != e {
+				t.Errorf("frame mismatch: %q, expected %q", s, e)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("no frame from the client")
+		}
+	}
+}
+
+func TestClientMalformed(t *testing.T) {
+	c := NewClient("ws://localhost/socket.io/", nopLogger{})
+	var errs []error
+	c.OnLifecycle(func(e eventio.LifecycleEvent) {
+		if e.Type == eventio.LifecycleError {
+			errs = append(errs, e.Err)
+		}
+	})
+	// an ack without an ID, and a packet of an unknown type
+	c.HandleMessage(`3["x"]`)
+	c.HandleMessage(`9`)
+	if len(errs) != 1 {
+		t.Error("errors mismatch", errs)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch s := string(data); {
+			case s == "40/chat,":
+				conn.WriteMessage(websocket.TextMessage, []byte(`40/chat,`))
+				conn.WriteMessage(websocket.TextMessage, []byte(`42/chat,["message","hi"]`))
+				conn.WriteMessage(websocket.TextMessage, []byte(`42["message","default"]`))
+			case s == "40/admin,":
+				conn.WriteMessage(websocket.TextMessage, []byte(`44/admin,"unauthorized"`))
+			case strings.HasPrefix(s, "42/chat,10001"):
+				conn.WriteMessage(websocket.TextMessage, []byte(`43/chat,10001["ok"]`))
+			default:
+				recv <- s
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	events := make(chan string, 10)
+	c.HandleFunc(func(p *Packet) {
+		events <- "/ " + string(p.Data[1].(json.RawMessage))
+	})
+	chat := c.Of("/chat")
+	chat.HandleFunc(func(p *Packet) {
+		events <- p.Namespace + " " + string(p.Data[1].(json.RawMessage))
+	})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	if err := chat.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if !chat.Connected() {
+		t.Error("/chat should be connected")
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-events:
+			got[e] = true
+		case <-time.After(time.Second * 5):
+			t.Fatal("no event")
+		}
+	}
+	if !got[`/chat "hi"`] || !got[`/ "default"`] {
+		t.Error("events should be routed per namespace", got)
+	}
+
+	ack, err := chat.SendAck([]interface{}{"join"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ack) != 1 || string(ack[0].(json.RawMessage)) != `"ok"` {
+		t.Error("ack mismatch", ack)
+	}
+
+	err = c.Of("/admin").Connect()
+	if ce, ok := err.(*ConnectError); !ok || ce.Namespace != "/admin" || string(ce.Data) != `"unauthorized"` {
+		t.Error("connect error mismatch", err)
+	}
+
+	if err := chat.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-recv:
+		if s != "41/chat," {
+			t.Errorf("frame mismatch: %q, expected %q", s, "41/chat,")
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("no disconnect frame")
+	}
+}
+
+func TestNamespaceConcurrentConnect(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":60000}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`40`))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			// /chat is never answered
+			recv <- string(data)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	c.SetAckTimeout(time.Millisecond * 100)
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	chat := c.Of("/chat")
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- chat.Connect()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrorAckTimeout) {
+				t.Error("Connect should time out", err)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("Connect hangs")
+		}
+	}
+	if s := <-recv; s != "40/chat," {
+		t.Error("frame mismatch", s)
+	}
+	select {
+	case s := <-recv:
+		t.Error("concurrent Connect should be sent once", s)
+	case <-time.After(time.Millisecond * 50):
+	}
+}
+
+func TestV5(t *testing.T) {
+	recv := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("EIO") != "4" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":5,"message":"Unsupported protocol version"}`))
+			return
+		}
+		var upgrader websocket.Upgrader
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(`0{"sid":"sid","upgrades":[],"pingInterval":25000,"pingTimeout":20000}`))
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			recv <- string(data)
+			switch string(data) {
+			case `40{"token":"abc"}`:
+				conn.WriteMessage(websocket.TextMessage, []byte(`40{"sid":"s1"}`))
+			case `40/admin,{"token":"abc"}`:
+				conn.WriteMessage(websocket.TextMessage, []byte(`44/admin,{"message":"Not authorized"}`))
+			case `4210001["ping"]`:
+				conn.WriteMessage(websocket.TextMessage, []byte(`4310001["pong"]`))
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(strings.Replace(server.URL, "http", "ws", 1)+"/socket.io/", nopLogger{})
+	c.SetAuth(map[string]string{"token": "abc"})
+	if err := c.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if n := c.Of(DefaultNamespace); !n.Connected() || n.ID() != "s1" {
+		t.Error("default namespace should be connected", n.Connected(), n.ID())
+	}
+	ack, err := c.SendAck([]interface{}{"ping"})
+	if err != nil || len(ack) != 1 || string(ack[0].(json.RawMessage)) != `"pong"` {
+		t.Error("ack mismatch", ack, err)
+	}
+	var ce *ConnectError
+	if err := c.Of("/admin").Connect(); !errors.As(err, &ce) || string(ce.Data) != `{"message":"Not authorized"}` {
+		t.Error("connect error mismatch", err)
+	}
+}
+
+func BenchmarkEncodePacket(b *testing.B) {
+	p := Packet{Type: Event, Namespace: "/chat", ID: intAddr(12), Data: []interface{}{"name", map[string]int{"a": 1}}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := EncodePacket(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodePacket(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodePacket(`2/chat,12["name",{"a":1}]`); err != nil {
+			b.Fatal(err)
+		}
+	}
+}